@@ -21,26 +21,49 @@ func NewRunBashCmd() RunBashCmd {
 	return RunBashCmd{}
 }
 
-// RunBashCmd executes a command in an interactive BASH shell
+// RvmProfile returns the path of the RVM profile script, if RVM provides the
+// Ruby of the build. Otherwise the Ruby on the PATH is used, e.g. one
+// installed by an MRI buildpack.
+func RvmProfile() (string, bool) {
+	rvmPath, ok := os.LookupEnv("rvm_path")
+	if !ok || rvmPath == "" {
+		return "", false
+	}
+
+	profile := filepath.Join(rvmPath, "profile.d", "rvm")
+	if _, err := os.Stat(profile); err != nil {
+		return "", false
+	}
+
+	return profile, true
+}
+
+// RunBashCmd executes a command in an interactive BASH shell. If the command
+// fails, its output on stdout and stderr is returned along with the error.
+// The RVM profile is sourced first if RVM is available.
 func (r RunBashCmd) RunBashCmd(command string, WorkingDir string) (string, error) {
 	logger := rvm.NewLogEmitter(os.Stdout)
 	stdout := ""
 
-	cmd := exec.Command("bash")
-	cmd.Dir = WorkingDir
-	cmd.Args = append(
-		cmd.Args,
-		"--login",
-		"-c",
-		strings.Join(
+	if profile, ok := RvmProfile(); ok {
+		command = strings.Join(
 			[]string{
 				"source",
-				filepath.Join(os.ExpandEnv("$rvm_path"), "profile.d", "rvm"),
+				profile,
 				"&&",
 				command,
 			},
 			" ",
-		),
+		)
+	}
+
+	cmd := exec.Command("bash")
+	cmd.Dir = WorkingDir
+	cmd.Args = append(
+		cmd.Args,
+		"--login",
+		"-c",
+		command,
 	)
 	cmd.Env = os.Environ()
 
@@ -72,7 +95,7 @@ func (r RunBashCmd) RunBashCmd(command string, WorkingDir string) (string, error
 			logger.Process("Command output on stderr:")
 			logger.Subprocess(stderrBuf.String())
 		}
-		return "", err
+		return stdout + stderrBuf.String(), err
 	}
 
 	logger.Break()
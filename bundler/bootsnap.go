@@ -0,0 +1,78 @@
+package bundler
+
+import (
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/paketo-buildpacks/packit/v2"
+	"github.com/paketo-buildpacks/packit/v2/chronos"
+	"github.com/paketo-buildpacks/packit/v2/scribe"
+)
+
+// bootsnapDirs lists the application directories whose Ruby and YAML files
+// are precompiled into the bootsnap cache
+var bootsnapDirs = []string{"app", "config", "lib"}
+
+// PrecompileBootsnap precompiles the bootsnap cache of the application and of
+// the gems of its bundle into the given layer, "bootsnap" by default, if
+// bootsnap is part of the bundle. The layer is only reset if the bundle
+// changed, so that unchanged files don't need to be compiled again. The
+// returned bool reports whether the layer has been created.
+func PrecompileBootsnap(context packit.BuildContext, layerName string, lock GemfileLock, checksum string, bashcmd BashCmd, logger scribe.Logger) (packit.Layer, bool, error) {
+	if !lock.Has("bootsnap") {
+		return packit.Layer{}, false, nil
+	}
+
+	clock := chronos.DefaultClock
+	timeStartPrecompile := clock.Now()
+
+	bootsnapLayer, err := context.Layers.Get(layerName)
+	if err != nil {
+		return packit.Layer{}, false, err
+	}
+
+	cachedSHA, ok := bootsnapLayer.Metadata["cache_sha"].(string)
+	if !ok || cachedSHA != checksum {
+		logger.Process("Resetting the bootsnap cache because the bundle changed")
+		bootsnapLayer, err = bootsnapLayer.Reset()
+		if err != nil {
+			return packit.Layer{}, false, err
+		}
+	} else {
+		logger.Process("Reusing the bootsnap cache %s", bootsnapLayer.Path)
+	}
+
+	logger.Process("Precompiling the bootsnap cache")
+
+	precompileCmd := []string{
+		"bundle",
+		"exec",
+		"bootsnap",
+		"precompile",
+		"--cache-dir",
+		bootsnapLayer.Path,
+		"--gemfile",
+	}
+	for _, dir := range bootsnapDirs {
+		if fileExists(filepath.Join(context.WorkingDir, dir)) {
+			precompileCmd = append(precompileCmd, dir)
+		}
+	}
+	_, err = bashcmd.RunBashCmd(strings.Join(precompileCmd, " "), context.WorkingDir)
+	if err != nil {
+		return packit.Layer{}, false, err
+	}
+
+	bootsnapLayer.Metadata = map[string]interface{}{
+		"cache_sha": checksum,
+	}
+	bootsnapLayer.LaunchEnv.Default("BOOTSNAP_CACHE_DIR", bootsnapLayer.Path)
+	bootsnapLayer.Cache, bootsnapLayer.Launch = true, true
+
+	timeDuration := clock.Now().Sub(timeStartPrecompile)
+	logger.Action("Bootsnap precompilation completed in %s", timeDuration.Round(time.Millisecond))
+	logger.Break()
+
+	return bootsnapLayer, true, nil
+}
@@ -0,0 +1,109 @@
+package bundler_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/avarteqgmbh/rvm-bundler-cnb/bundler"
+	"github.com/avarteqgmbh/rvm-bundler-cnb/bundler/fakes"
+	"github.com/paketo-buildpacks/packit/v2"
+	"github.com/paketo-buildpacks/packit/v2/scribe"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testBootsnap(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+
+		workingDir string
+		layersDir  string
+		bashCmd    *fakes.BashCmd
+		logger     scribe.Logger
+		ctx        packit.BuildContext
+		lock       bundler.GemfileLock
+	)
+
+	it.Before(func() {
+		var err error
+		workingDir, err = ioutil.TempDir("", "working-dir")
+		Expect(err).NotTo(HaveOccurred())
+
+		layersDir, err = ioutil.TempDir("", "layers")
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(os.MkdirAll(filepath.Join(workingDir, "app"), os.ModePerm)).To(Succeed())
+		Expect(os.MkdirAll(filepath.Join(workingDir, "config"), os.ModePerm)).To(Succeed())
+
+		bashCmd = &fakes.BashCmd{}
+		logger = scribe.NewLogger(bytes.NewBuffer(nil))
+		ctx = packit.BuildContext{
+			WorkingDir: workingDir,
+			Layers:     packit.Layers{Path: layersDir},
+		}
+		lock = bundler.GemfileLock{Specs: map[string]string{"bootsnap": "1.12.0"}}
+	})
+
+	it.After(func() {
+		Expect(os.RemoveAll(workingDir)).To(Succeed())
+		Expect(os.RemoveAll(layersDir)).To(Succeed())
+	})
+
+	it("precompiles the application and the gems into a launch layer", func() {
+		layer, ok, err := bundler.PrecompileBootsnap(ctx, "bootsnap", lock, "some-checksum", bashCmd, logger)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ok).To(BeTrue())
+
+		layerPath := filepath.Join(layersDir, "bootsnap")
+		Expect(bashCmd.RunBashCmdCall.Receives.Command).To(Equal(
+			fmt.Sprintf("bundle exec bootsnap precompile --cache-dir %s --gemfile app config", layerPath),
+		))
+		Expect(layer.Launch).To(BeTrue())
+		Expect(layer.Cache).To(BeTrue())
+		Expect(layer.Build).To(BeFalse())
+		Expect(layer.Metadata).To(Equal(map[string]interface{}{"cache_sha": "some-checksum"}))
+		Expect(layer.LaunchEnv).To(HaveKeyWithValue("BOOTSNAP_CACHE_DIR.default", layerPath))
+	})
+
+	it("keeps the cache when the bundle didn't change", func() {
+		layerPath := filepath.Join(layersDir, "bootsnap")
+		Expect(os.MkdirAll(filepath.Join(layerPath, "bootsnap"), os.ModePerm)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(layersDir, "bootsnap.toml"), []byte("[metadata]\ncache_sha = \"some-checksum\"\n"), 0644)).To(Succeed())
+
+		_, ok, err := bundler.PrecompileBootsnap(ctx, "bootsnap", lock, "some-checksum", bashCmd, logger)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ok).To(BeTrue())
+		Expect(filepath.Join(layerPath, "bootsnap")).To(BeADirectory())
+	})
+
+	it("resets the cache when the bundle changed", func() {
+		layerPath := filepath.Join(layersDir, "bootsnap")
+		Expect(os.MkdirAll(filepath.Join(layerPath, "bootsnap"), os.ModePerm)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(layersDir, "bootsnap.toml"), []byte("[metadata]\ncache_sha = \"some-checksum\"\n"), 0644)).To(Succeed())
+
+		_, ok, err := bundler.PrecompileBootsnap(ctx, "bootsnap", lock, "other-checksum", bashCmd, logger)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ok).To(BeTrue())
+		Expect(filepath.Join(layerPath, "bootsnap")).NotTo(BeADirectory())
+	})
+
+	it("does nothing if bootsnap isn't part of the bundle", func() {
+		_, ok, err := bundler.PrecompileBootsnap(ctx, "bootsnap", bundler.GemfileLock{}, "some-checksum", bashCmd, logger)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ok).To(BeFalse())
+		Expect(bashCmd.RunBashCmdCall.CallCount).To(Equal(0))
+	})
+
+	it("returns an error if the precompilation fails", func() {
+		bashCmd.RunBashCmdCall.Returns.Error = errors.New("failed to precompile")
+
+		_, _, err := bundler.PrecompileBootsnap(ctx, "bootsnap", lock, "some-checksum", bashCmd, logger)
+		Expect(err).To(MatchError("failed to precompile"))
+	})
+}
@@ -14,10 +14,10 @@ func Build(
 	bc RunBashCmd,
 	pm PumaInstaller) packit.BuildFunc {
 	return func(context packit.BuildContext) (packit.BuildResult, error) {
-		configuration, err := ReadConfiguration(context.CNBPath)
+		configuration, err := LoadConfiguration(context.CNBPath, context.WorkingDir)
 		if err != nil {
 			return packit.BuildResult{}, err
 		}
-		return InstallBundler(context, configuration, logger, vr, calc, bc, pm)
+		return InstallBundles(context, configuration, logger, vr, calc, bc, pm)
 	}
 }
@@ -9,6 +9,31 @@ import (
 // BuildPackYML represents the buildpack.yml file provided by a user / an app
 type BuildPackYML struct {
 	BundlerVersion string `yaml:"bundler_version"`
+	WebServer      string `yaml:"web_server"`
+	DefaultProcess string `yaml:"default_process"`
+	Standalone     *bool  `yaml:"standalone"`
+	Binstubs       *bool  `yaml:"binstubs"`
+
+	PostInstallTasks     []string `yaml:"post_install_tasks"`
+	PostInstallCacheDirs []string `yaml:"post_install_cache_dirs"`
+	PreBundleHook        string   `yaml:"pre_bundle_hook"`
+	PostBundleHook       string   `yaml:"post_bundle_hook"`
+	Verify               *bool    `yaml:"verify"`
+	SmokeCommand         string   `yaml:"smoke_command"`
+	Ccache               *bool    `yaml:"ccache"`
+	Prune                *bool    `yaml:"prune"`
+	PrunePatterns        []string `yaml:"prune_patterns"`
+	PruneKeep            []string `yaml:"prune_keep"`
+	StripDebug           *bool    `yaml:"strip_debug"`
+	Reproducible         *bool    `yaml:"reproducible"`
+
+	RubyVersionSensitivity string `yaml:"ruby_version_sensitivity"`
+	RubyVersionCheck       string `yaml:"ruby_version_check"`
+	PlatformCheck          string `yaml:"platform_check"`
+	LockfilePolicy         string `yaml:"lockfile_policy"`
+
+	AppRoot  string   `yaml:"app_root"`
+	Gemfiles []string `yaml:"gemfiles"`
 }
 
 // BuildpackYMLParser represents the buildpack.yml parser
@@ -0,0 +1,297 @@
+package bundler
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/paketo-buildpacks/packit/v2"
+	"github.com/paketo-buildpacks/packit/v2/scribe"
+)
+
+// bundleNameRegex matches the characters of a Gemfile path that aren't
+// allowed in the name of a bundle
+var bundleNameRegex = regexp.MustCompile(`[^a-z0-9]+`)
+
+// Bundle represents a Gemfile of the application that is installed into its
+// own layer. The primary bundle has no name, the other bundles of a monorepo
+// are named after the path of their Gemfile, e.g. "services-api".
+type Bundle struct {
+	Name string
+	// Dir is the directory the Bundler commands and the processes of the
+	// bundle run in
+	Dir string
+	// GemfilePath is the Gemfile listed in the configuration, if any,
+	// otherwise the Gemfile is found in Dir
+	GemfilePath string
+	// Scoped is set if the application has several bundles, the launch
+	// environment of the bundle is then only set for its own processes
+	Scoped bool
+}
+
+// LayerName returns the name of the given layer for the bundle, e.g.
+// "rvm-bundler-services-api"
+func (b Bundle) LayerName(name string) string {
+	if b.Name == "" {
+		return name
+	}
+
+	return fmt.Sprintf("%s-%s", name, b.Name)
+}
+
+// ProcessType returns the given process type for the bundle, e.g.
+// "services-api-web"
+func (b Bundle) ProcessType(processType string) string {
+	if b.Name == "" {
+		return processType
+	}
+
+	return fmt.Sprintf("%s-%s", b.Name, processType)
+}
+
+// Gemfile returns the Gemfile of the bundle
+func (b Bundle) Gemfile() Gemfile {
+	if b.GemfilePath == "" {
+		return FindGemfile(b.Dir)
+	}
+
+	return NewGemfile(b.GemfilePath)
+}
+
+// CacheLayers are the cache layers shared by the bundles of the application
+type CacheLayers struct {
+	GemCache packit.Layer
+	// Ccache is only used if UseCcache is set, see PrepareCcache
+	Ccache    packit.Layer
+	UseCcache bool
+	// Jars is only used on JRuby, see PrepareJarsCache
+	Jars    packit.Layer
+	UseJars bool
+}
+
+// PrepareCacheLayers prepares the cache layers for the Ruby used in the given
+// directory. They are prepared once for all bundles of the application.
+func PrepareCacheLayers(context packit.BuildContext, dir string, configuration Configuration, versionResolver VersionResolver, bashcmd BashCmd, logger scribe.Logger) (CacheLayers, error) {
+	rubyVersion, err := versionResolver.Lookup(dir, bashcmd)
+	if err != nil {
+		return CacheLayers{}, err
+	}
+
+	var caches CacheLayers
+	caches.GemCache, err = PrepareGemCache(context, logger)
+	if err != nil {
+		return CacheLayers{}, err
+	}
+
+	if rubyVersion.Engine == EngineJRuby {
+		caches.Jars, err = PrepareJarsCache(context, logger)
+		if err != nil {
+			return CacheLayers{}, err
+		}
+		caches.UseJars = true
+	}
+
+	caches.Ccache, caches.UseCcache, err = PrepareCcache(context, rubyVersion, configuration, bashcmd, logger)
+	if err != nil {
+		return CacheLayers{}, err
+	}
+
+	return caches, nil
+}
+
+// FindBundles returns the bundles of the application. By default this is the
+// bundle of the app root, a subdirectory of the application if configured.
+// For a monorepo every configured Gemfile, relative to the app root, is a
+// bundle of its own running in the directory of the Gemfile. The first one is
+// the primary bundle.
+func FindBundles(workingDir string, configuration Configuration) ([]Bundle, error) {
+	appRoot, err := appPath(workingDir, workingDir, configuration.AppRoot)
+	if err != nil {
+		return nil, fmt.Errorf("invalid app root '%s': %w", configuration.AppRoot, err)
+	}
+
+	info, err := os.Stat(appRoot)
+	if err != nil {
+		return nil, fmt.Errorf("invalid app root '%s': %w", configuration.AppRoot, err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("invalid app root '%s': not a directory", configuration.AppRoot)
+	}
+
+	if len(configuration.Gemfiles) == 0 {
+		return []Bundle{{Dir: appRoot}}, nil
+	}
+
+	bundles := []Bundle{}
+	names := map[string]string{}
+	dirs := map[string]string{}
+	for i, path := range configuration.Gemfiles {
+		gemfilePath, err := appPath(workingDir, appRoot, path)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Gemfile '%s': %w", path, err)
+		}
+
+		_, err = os.Stat(gemfilePath)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Gemfile '%s': %w", path, err)
+		}
+
+		// the bundles of a directory would share its local Bundler
+		// configuration, including the path the gems are installed to
+		if other, ok := dirs[filepath.Dir(gemfilePath)]; ok {
+			return nil, fmt.Errorf("the Gemfiles '%s' and '%s' are in the same directory and can't be installed as separate bundles", other, path)
+		}
+		dirs[filepath.Dir(gemfilePath)] = path
+
+		bundle := Bundle{
+			Dir:         filepath.Dir(gemfilePath),
+			GemfilePath: gemfilePath,
+			Scoped:      len(configuration.Gemfiles) > 1,
+		}
+		if i > 0 {
+			bundle.Name = bundleName(appRoot, gemfilePath)
+		}
+
+		if other, ok := names[bundle.Name]; ok {
+			return nil, fmt.Errorf("the Gemfiles '%s' and '%s' can't be installed into the same layer", other, path)
+		}
+		names[bundle.Name] = path
+
+		bundles = append(bundles, bundle)
+	}
+
+	return bundles, nil
+}
+
+// appPath returns the given path relative to the base directory as an
+// absolute path, which has to be inside the application
+func appPath(workingDir, base, path string) (string, error) {
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(base, path)
+	}
+	path = filepath.Clean(path)
+
+	rel, err := filepath.Rel(workingDir, path)
+	if err != nil {
+		return "", err
+	}
+
+	if rel == ".." || strings.HasPrefix(rel, fmt.Sprintf("..%c", filepath.Separator)) {
+		return "", fmt.Errorf("%s is outside of the application", path)
+	}
+
+	return path, nil
+}
+
+// bundleName returns the name of the bundle of a Gemfile, derived from its
+// directory or, if it isn't named Gemfile or gems.rb, from its path
+func bundleName(appRoot, gemfilePath string) string {
+	rel, err := filepath.Rel(appRoot, gemfilePath)
+	if err != nil {
+		rel = gemfilePath
+	}
+
+	switch filepath.Base(rel) {
+	case "Gemfile", "gems.rb":
+		rel = filepath.Dir(rel)
+	default:
+		rel = strings.TrimSuffix(rel, filepath.Ext(rel))
+	}
+
+	name := strings.Trim(bundleNameRegex.ReplaceAllString(strings.ToLower(rel), "-"), "-")
+	if name == "" {
+		return "app"
+	}
+
+	return name
+}
+
+// scopeProcesses runs the processes of a bundle in its directory. The
+// processes of a bundle other than the primary one are prefixed with its name.
+// For a scoped bundle the launch environment of its layers, e.g.
+// BUNDLE_GEMFILE and BUNDLE_USER_CONFIG, isn't exported to the whole image but
+// overrides the environment of the processes of the bundle only, so that the
+// bundles don't pick up each other's Gemfile.
+func scopeProcesses(result *packit.BuildResult, bundle Bundle, appDir string, layerNames ...string) {
+	var envLayer *packit.Layer
+	launchEnv := packit.Environment{}
+	if bundle.Scoped {
+		for i, layer := range result.Layers {
+			if !contains(layerNames, layer.Name) {
+				continue
+			}
+
+			if layer.Name == layerNames[0] {
+				envLayer = &result.Layers[i]
+			}
+
+			for key, value := range layer.LaunchEnv {
+				if strings.HasSuffix(key, ".default") {
+					key = strings.TrimSuffix(key, ".default") + ".override"
+				}
+				launchEnv[key] = value
+			}
+			result.Layers[i].LaunchEnv = packit.Environment{}
+			if bundle.Name != "" {
+				result.Layers[i].BuildEnv = packit.Environment{}
+			}
+		}
+	}
+
+	for i := range result.Launch.Processes {
+		process := &result.Launch.Processes[i]
+
+		if bundle.Dir != appDir {
+			process.WorkingDirectory = bundle.Dir
+		}
+
+		if bundle.Name != "" {
+			process.Type = bundle.ProcessType(process.Type)
+			process.Default = false
+		}
+
+		if envLayer != nil {
+			if envLayer.ProcessLaunchEnv == nil {
+				envLayer.ProcessLaunchEnv = map[string]packit.Environment{}
+			}
+			envLayer.ProcessLaunchEnv[process.Type] = launchEnv
+		}
+	}
+}
+
+// snapshotEnv returns a function that resets the environment of the build to
+// its current state
+func snapshotEnv() func() {
+	env := os.Environ()
+
+	return func() {
+		os.Clearenv()
+		for _, variable := range env {
+			name, value, _ := strings.Cut(variable, "=")
+			os.Setenv(name, value)
+		}
+	}
+}
+
+// mergeBuildResults adds the layers and processes of a bundle to the result
+// of the build. Layers shared by the bundles, like the gem cache, are only
+// returned once.
+func mergeBuildResults(result *packit.BuildResult, other packit.BuildResult) {
+	for _, layer := range other.Layers {
+		shared := false
+		for i := range result.Layers {
+			if result.Layers[i].Name == layer.Name {
+				result.Layers[i] = layer
+				shared = true
+			}
+		}
+
+		if !shared {
+			result.Layers = append(result.Layers, layer)
+		}
+	}
+
+	result.Launch.Processes = append(result.Launch.Processes, other.Launch.Processes...)
+}
@@ -0,0 +1,143 @@
+package bundler_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/avarteqgmbh/rvm-bundler-cnb/bundler"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testBundle(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+
+		workingDir string
+	)
+
+	it.Before(func() {
+		var err error
+		workingDir, err = ioutil.TempDir("", "working-dir")
+		Expect(err).NotTo(HaveOccurred())
+
+		for _, dir := range []string{"services/api", "services/worker", "gemfiles"} {
+			Expect(os.MkdirAll(filepath.Join(workingDir, dir), os.ModePerm)).To(Succeed())
+		}
+		Expect(ioutil.WriteFile(filepath.Join(workingDir, "services", "api", "Gemfile"), nil, 0644)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(workingDir, "services", "worker", "gems.rb"), nil, 0644)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(workingDir, "gemfiles", "rails7.gemfile"), nil, 0644)).To(Succeed())
+	})
+
+	it.After(func() {
+		Expect(os.RemoveAll(workingDir)).To(Succeed())
+	})
+
+	context("FindBundles", func() {
+		it("returns the bundle of the application by default", func() {
+			bundles, err := bundler.FindBundles(workingDir, bundler.Configuration{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(bundles).To(Equal([]bundler.Bundle{{Dir: workingDir}}))
+		})
+
+		it("returns the bundle of the app root", func() {
+			bundles, err := bundler.FindBundles(workingDir, bundler.Configuration{AppRoot: "services/api"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(bundles).To(Equal([]bundler.Bundle{{Dir: filepath.Join(workingDir, "services", "api")}}))
+		})
+
+		it("returns a bundle for every Gemfile relative to the app root", func() {
+			bundles, err := bundler.FindBundles(workingDir, bundler.Configuration{
+				AppRoot:  "services",
+				Gemfiles: []string{"api/Gemfile", "worker/gems.rb", "../gemfiles/rails7.gemfile"},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(bundles).To(Equal([]bundler.Bundle{
+				{
+					Dir:         filepath.Join(workingDir, "services", "api"),
+					GemfilePath: filepath.Join(workingDir, "services", "api", "Gemfile"),
+					Scoped:      true,
+				},
+				{
+					Name:        "worker",
+					Dir:         filepath.Join(workingDir, "services", "worker"),
+					GemfilePath: filepath.Join(workingDir, "services", "worker", "gems.rb"),
+					Scoped:      true,
+				},
+				{
+					Name:        "gemfiles-rails7",
+					Dir:         filepath.Join(workingDir, "gemfiles"),
+					GemfilePath: filepath.Join(workingDir, "gemfiles", "rails7.gemfile"),
+					Scoped:      true,
+				},
+			}))
+		})
+
+		it("fails for an app root outside of the application", func() {
+			_, err := bundler.FindBundles(workingDir, bundler.Configuration{AppRoot: "../other"})
+			Expect(err).To(MatchError(ContainSubstring("invalid app root '../other'")))
+			Expect(err).To(MatchError(ContainSubstring("is outside of the application")))
+		})
+
+		it("fails for a missing app root", func() {
+			_, err := bundler.FindBundles(workingDir, bundler.Configuration{AppRoot: "services/web"})
+			Expect(err).To(MatchError(ContainSubstring("invalid app root 'services/web'")))
+		})
+
+		it("fails for a missing Gemfile", func() {
+			_, err := bundler.FindBundles(workingDir, bundler.Configuration{Gemfiles: []string{"services/api/Gemfile", "services/web/Gemfile"}})
+			Expect(err).To(MatchError(ContainSubstring("invalid Gemfile 'services/web/Gemfile'")))
+		})
+
+		it("fails for Gemfiles sharing a directory", func() {
+			Expect(ioutil.WriteFile(filepath.Join(workingDir, "services", "worker", "Gemfile"), nil, 0644)).To(Succeed())
+
+			_, err := bundler.FindBundles(workingDir, bundler.Configuration{
+				AppRoot:  "services",
+				Gemfiles: []string{"api/Gemfile", "worker/Gemfile", "worker/gems.rb"},
+			})
+			Expect(err).To(MatchError("the Gemfiles 'worker/Gemfile' and 'worker/gems.rb' are in the same directory and can't be installed as separate bundles"))
+		})
+
+		it("fails for Gemfiles sharing a layer", func() {
+			for _, dir := range []string{"services-api", "services/api"} {
+				Expect(os.MkdirAll(filepath.Join(workingDir, dir), os.ModePerm)).To(Succeed())
+				Expect(ioutil.WriteFile(filepath.Join(workingDir, dir, "Gemfile"), nil, 0644)).To(Succeed())
+			}
+
+			_, err := bundler.FindBundles(workingDir, bundler.Configuration{
+				Gemfiles: []string{"gemfiles/rails7.gemfile", "services-api/Gemfile", "services/api/Gemfile"},
+			})
+			Expect(err).To(MatchError("the Gemfiles 'services-api/Gemfile' and 'services/api/Gemfile' can't be installed into the same layer"))
+		})
+	})
+
+	context("Bundle", func() {
+		it("names the layers and processes of the primary bundle as usual", func() {
+			bundle := bundler.Bundle{Dir: workingDir}
+			Expect(bundle.LayerName("rvm-bundler")).To(Equal("rvm-bundler"))
+			Expect(bundle.ProcessType("web")).To(Equal("web"))
+		})
+
+		it("names the layers and processes of the other bundles after the bundle", func() {
+			bundle := bundler.Bundle{Name: "worker", Dir: filepath.Join(workingDir, "services", "worker")}
+			Expect(bundle.LayerName("rvm-bundler")).To(Equal("rvm-bundler-worker"))
+			Expect(bundle.ProcessType("web")).To(Equal("worker-web"))
+		})
+
+		it("returns the configured Gemfile", func() {
+			bundle := bundler.Bundle{
+				Name:        "worker",
+				Dir:         filepath.Join(workingDir, "services", "worker"),
+				GemfilePath: filepath.Join(workingDir, "services", "worker", "gems.rb"),
+			}
+			Expect(bundle.Gemfile()).To(Equal(bundler.Gemfile{
+				Path:     filepath.Join(workingDir, "services", "worker", "gems.rb"),
+				LockPath: filepath.Join(workingDir, "services", "worker", "gems.locked"),
+			}))
+		})
+	})
+}
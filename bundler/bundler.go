@@ -1,10 +1,12 @@
 package bundler
 
 import (
+	"bytes"
 	"fmt"
 	"os"
 	"path/filepath"
-	"regexp"
+	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -19,11 +21,12 @@ import (
 //go:generate faux --interface VersionResolver --output fakes/version_resolver.go
 //go:generate faux --interface BashCmd --output fakes/bash_cmd.go
 //go:generate faux --interface PumaInstaller --output fakes/puma.go
+//go:generate faux --package github.com/paketo-buildpacks/packit/v2 --interface ExitHandler --output fakes/exit_handler.go
 
 // VersionResolver defines the interface for looking up and comparing the
 // versions of Ruby installed in the environment.
 type VersionResolver interface {
-	Lookup(workingDir string, bashcmd BashCmd) (version string, err error)
+	Lookup(workingDir string, bashcmd BashCmd) (version RubyVersion, err error)
 }
 
 // Calculator defines the interface for calculating a checksum of the given set
@@ -57,32 +60,187 @@ func InstallBundler(context packit.BuildContext, configuration Configuration, lo
 	logger.Title("%s %s", context.BuildpackInfo.Name, context.BuildpackInfo.Version)
 	logger.Process("default Bundler version: %s\n", bundlerVersion(context, configuration))
 
+	_, err := parseBundlerMajorVersion(context, configuration, logger)
+	if err != nil {
+		return packit.BuildResult{}, err
+	}
+
+	caches, err := PrepareCacheLayers(context, context.WorkingDir, configuration, versionResolver, bashcmd, logger)
+	if err != nil {
+		return packit.BuildResult{}, err
+	}
+
+	return InstallBundle(context, configuration, Bundle{Dir: context.WorkingDir}, caches, logger, versionResolver, calculator, bashcmd, pumainstaller)
+}
+
+// InstallBundles installs every bundle of the application as found by
+// FindBundles, each into its own layer, and returns the layers and processes
+// of all of them. The cache layers are shared by the bundles. The environment
+// set up for a bundle, e.g. BUNDLE_JOBS or BUNDLE_USER_CONFIG, is reset
+// before the next one is installed, the whole environment when returning.
+func InstallBundles(context packit.BuildContext, configuration Configuration, logger scribe.Logger, versionResolver VersionResolver, calculator Calculator, bashcmd BashCmd, pumainstaller PumaInstaller) (packit.BuildResult, error) {
+	logger.Title("%s %s", context.BuildpackInfo.Name, context.BuildpackInfo.Version)
+	logger.Process("default Bundler version: %s\n", bundlerVersion(context, configuration))
+
+	bundles, err := FindBundles(context.WorkingDir, configuration)
+	if err != nil {
+		return packit.BuildResult{}, err
+	}
+
+	_, err = parseBundlerMajorVersion(context, configuration, logger)
+	if err != nil {
+		return packit.BuildResult{}, err
+	}
+
+	defer snapshotEnv()()
+
+	// The layer metadata is only written at the end of the build, a bundle
+	// preparing the cache layers again would see the metadata of the
+	// previous build and reset the layers filled by the bundles before it
+	caches, err := PrepareCacheLayers(context, bundles[0].Dir, configuration, versionResolver, bashcmd, logger)
+	if err != nil {
+		return packit.BuildResult{}, err
+	}
+
+	var buildResult packit.BuildResult
+	for _, bundle := range bundles {
+		if len(bundles) > 1 || bundle.Dir != context.WorkingDir {
+			gemfilePath, _ := bundle.Gemfile().Rel(context.WorkingDir)
+			logger.Process("Installing the bundle of %s into the layer %s", gemfilePath, bundle.LayerName("rvm-bundler"))
+			logger.Break()
+		}
+
+		restoreEnv := snapshotEnv()
+		result, err := InstallBundle(context, configuration, bundle, caches, logger, versionResolver, calculator, bashcmd, pumainstaller)
+		restoreEnv()
+		if err != nil {
+			return packit.BuildResult{}, err
+		}
+
+		mergeBuildResults(&buildResult, result)
+	}
+
+	return buildResult, nil
+}
+
+// InstallBundle installs a bundle of the application into its layer, see
+// InstallBundler. The Bundler commands run in the directory of the bundle
+// with BUNDLE_GEMFILE set to its Gemfile, if configured, and use the given
+// cache layers.
+func InstallBundle(context packit.BuildContext, configuration Configuration, bundle Bundle, caches CacheLayers, logger scribe.Logger, versionResolver VersionResolver, calculator Calculator, bashcmd BashCmd, pumainstaller PumaInstaller) (packit.BuildResult, error) {
+	appDir := context.WorkingDir
+	context.WorkingDir = bundle.Dir
+
+	if bundle.GemfilePath != "" {
+		previous, ok := os.LookupEnv("BUNDLE_GEMFILE")
+		os.Setenv("BUNDLE_GEMFILE", bundle.GemfilePath)
+		defer func() {
+			if ok {
+				os.Setenv("BUNDLE_GEMFILE", previous)
+			} else {
+				os.Unsetenv("BUNDLE_GEMFILE")
+			}
+		}()
+	}
+
 	clock := chronos.DefaultClock
 
 	var buildMetadata packit.BuildMetadata
 	var launchMetadata packit.LaunchMetadata
 
-	bundlerMajorVersion, err := strconv.Atoi(bundlerVersion(context, configuration)[:1])
+	bundlerMajorVersion, err := parseBundlerMajorVersion(context, configuration, logger)
 	if err != nil {
-		logger.Process("Failed to determine bundler major version")
 		return packit.BuildResult{}, err
 	}
 
-	bundlerLayer, err := context.Layers.Get("rvm-bundler")
+	if configuration.Standalone && bundlerMajorVersion < 2 {
+		return packit.BuildResult{}, fmt.Errorf("bundler standalone mode requires Bundler 2 or later, got %s", bundlerVersion(context, configuration))
+	}
+
+	bundlerLayer, err := context.Layers.Get(bundle.LayerName("rvm-bundler"))
 	if err != nil {
 		return packit.BuildResult{}, err
 	}
 
-	should, checksum, rubyVersion, err := ShouldRun(bundlerLayer.Metadata, context.WorkingDir, versionResolver, calculator, bashcmd)
+	var sourceDateEpoch *time.Time
+	if configuration.Reproducible {
+		epoch, ok, err := SourceDateEpoch()
+		if err != nil {
+			return packit.BuildResult{}, err
+		}
+
+		if ok {
+			sourceDateEpoch = &epoch
+		}
+	}
+
+	generatedLockfile, err := RestoreLockfile(context.WorkingDir, bundlerLayer.Path, configuration, logger)
+	if err != nil {
+		return packit.BuildResult{}, err
+	}
+
+	should, checksum, rubyVersion, err := ShouldRun(bundlerLayer.Metadata, context.WorkingDir, configuration.RubyVersionSensitivity, versionResolver, calculator, bashcmd, HookPaths(context.WorkingDir, configuration)...)
 	if err != nil {
 		return packit.BuildResult{}, err
 	}
 
-	rubyMajorVersion, rubyMinorVersion, err := extractRubyVersion(rubyVersion)
+	rubyVersionKey, err := rubyVersion.CacheKey(configuration.RubyVersionSensitivity)
 	if err != nil {
 		return packit.BuildResult{}, err
 	}
 
+	enginePolicy := NewEnginePolicy(rubyVersion, bundlerMajorVersion)
+	configuration = enginePolicy.Configure(configuration, logger)
+
+	// Gems pruned with other options can't be restored by "bundle install",
+	// so the bundle is installed from scratch if an option changed
+	options := installOptions(configuration)
+	if _, installed := bundlerLayer.Metadata["cache_sha"]; installed {
+		if option := changedInstallOption(bundlerLayer.Metadata, options); option != "" {
+			logger.Process("The option '%s' changed, reinstalling the bundle from scratch", option)
+			err = cleanBundlerLayer(bundlerLayer.Path)
+			if err != nil {
+				return packit.BuildResult{}, err
+			}
+			should = true
+		}
+	}
+
+	gemfile := FindGemfile(context.WorkingDir)
+
+	appLock, err := ParseGemfileLock(gemfile.LockPath)
+	if err != nil && !os.IsNotExist(err) {
+		return packit.BuildResult{}, err
+	}
+
+	err = CheckRubyVersionConsistency(context.WorkingDir, appLock, rubyVersion, configuration, logger)
+	if err != nil {
+		return packit.BuildResult{}, err
+	}
+
+	platform := BuildPlatform(runtime.GOARCH, MuslLoaderGlob)
+	addPlatform := false
+	if rubyVersion.Engine == EngineJRuby {
+		CheckJavaPlatform(appLock, logger)
+		logger.Break()
+	} else {
+		addPlatform, err = CheckLockPlatform(context.WorkingDir, appLock, platform, configuration, logger)
+		if err != nil {
+			return packit.BuildResult{}, err
+		}
+	}
+
+	// The application's Gemfile.lock is replaced by a copy with the platform
+	// of the build until the bundle is installed and verified. It is restored
+	// at the end of the build and, if the build fails, when returning the
+	// error.
+	var restoreLockfile func() error
+	defer func() {
+		if restoreLockfile != nil {
+			_ = restoreLockfile()
+		}
+	}()
+
 	localConfigPath := filepath.Join(context.WorkingDir, ".bundle", "config")
 	backupConfigPath := filepath.Join(context.WorkingDir, ".bundle", "config.bak")
 	globalConfigPath := filepath.Join(bundlerLayer.Path, "config")
@@ -118,59 +276,121 @@ func InstallBundler(context packit.BuildContext, configuration Configuration, lo
 
 	os.Setenv("BUNDLE_USER_CONFIG", globalConfigPath)
 
-	if should {
-		timeStartInstall := clock.Now()
-		logger.Process("Installing Bundler version '%s'", bundlerVersion(context, configuration))
+	// The pre-bundle hook runs on every build before the Gemfile is evaluated
+	// for the first time, it may generate files the Gemfile or gemspecs read
+	err = RunHook("pre-bundle", configuration.PreBundleHook, context.WorkingDir, bashcmd, logger)
+	if err != nil {
+		return packit.BuildResult{}, err
+	}
 
-		rubyGemsVersion := ""
-		rubyMajorCheck := "2"
-		rubyMinorCheck := []string{"6", "7"}
-		if bundlerMajorVersion == 1 {
-			rubyGemsVersion = "3.0.8"
-		} else if rubyMajorVersion == rubyMajorCheck && contains(rubyMinorCheck, rubyMinorVersion) {
-			// ruby gems 3.4.22 is the latest with Ruby 2.6 and 2.7 support
-			rubyGemsVersion = "3.4.22"
-		}
+	// Puma is added to the Gemfile on every build, also if the layer is
+	// reused, while the cache key is computed from the Gemfile as checked out
+	pristineGemfile, err := os.ReadFile(gemfile.Path)
+	if err != nil && !os.IsNotExist(err) {
+		return packit.BuildResult{}, err
+	}
 
-		logger.Process("rubygems-update version explicitly set to '%s'", rubyGemsVersion)
+	err = pumainstaller.InstallPuma(context, configuration, logger)
+	if err != nil {
+		return packit.BuildResult{}, err
+	}
 
-		installRubyGemsUpdateSystemCmd := strings.Join([]string{
-			"gem",
-			"install",
-			"-N",
-			"rubygems-update",
-		}, " ")
-		if len(rubyGemsVersion) > 0 {
-			installRubyGemsUpdateSystemCmd = strings.Join([]string{
-				installRubyGemsUpdateSystemCmd,
-				"-v",
-				rubyGemsVersion,
-			}, " ")
-		}
-		_, err = bashcmd.RunBashCmd(installRubyGemsUpdateSystemCmd, context.WorkingDir)
+	if !should {
+		logger.Process("Reusing cached layer %s", bundlerLayer.Path)
+
+		err = configureBundlerPath(context, bundlerLayer, bundlerMajorVersion, bashcmd)
 		if err != nil {
 			return packit.BuildResult{}, err
 		}
 
-		gemUpdateSystemCmd := strings.Join([]string{
-			"gem",
-			"update",
-			"-N",
-			"--system",
-			rubyGemsVersion,
-		}, " ")
-		_, err = bashcmd.RunBashCmd(gemUpdateSystemCmd, context.WorkingDir)
-		if err != nil {
-			return packit.BuildResult{}, err
+		if addPlatform {
+			restoreLockfile, err = UseLockPlatform(context.WorkingDir, bundlerLayer.Path, platform, false, bashcmd, logger)
+			if err != nil {
+				return packit.BuildResult{}, err
+			}
 		}
 
-		gemCleanupCmd := strings.Join([]string{"gem", "cleanup"}, " ")
-		_, err = bashcmd.RunBashCmd(gemCleanupCmd, context.WorkingDir)
+		reason, err := CheckLayerIntegrity(context.WorkingDir, bundlerLayer, bashcmd)
 		if err != nil {
 			return packit.BuildResult{}, err
 		}
 
-		err = pumainstaller.InstallPuma(context, configuration, logger)
+		if reason != "" {
+			logger.Process("Cached layer failed the integrity check: %s", reason)
+			logger.Process("Falling back to a clean reinstall")
+
+			err = cleanBundlerLayer(bundlerLayer.Path)
+			if err != nil {
+				return packit.BuildResult{}, err
+			}
+			should = true
+		} else if binstubsMissing(bundlerLayer.Path, configuration) {
+			logger.Process("Writing the binstubs missing from the cached layer")
+
+			err = installBinstubs(context, bundlerLayer, configuration, bundlerMajorVersion, bashcmd, logger)
+			if err != nil {
+				return packit.BuildResult{}, err
+			}
+		}
+		logger.Break()
+	}
+
+	if should {
+		timeStartInstall := clock.Now()
+
+		cachedRubyVersion, ok := bundlerLayer.Metadata["ruby_version"].(string)
+		if ok && cachedRubyVersion != rubyVersionKey {
+			logger.Process("Ruby changed from '%s' to '%s', removing the gems installed for the old Ruby ABI", cachedRubyVersion, rubyVersionKey)
+			err = cleanBundlerLayer(bundlerLayer.Path)
+			if err != nil {
+				return packit.BuildResult{}, err
+			}
+		}
+
+		ConfigureParallelism(context.WorkingDir, AvailableCPUs(CgroupRoot), logger)
+
+		logger.Process("Installing Bundler version '%s'", bundlerVersion(context, configuration))
+
+		if enginePolicy.KeepRubyGems {
+			logger.Process("Keeping the RubyGems version bundled with %s", rubyVersion)
+		} else {
+			rubyGemsVersion := enginePolicy.RubyGemsVersion
+
+			logger.Process("rubygems-update version explicitly set to '%s'", rubyGemsVersion)
+
+			installRubyGemsUpdateSystemCmd := strings.Join([]string{
+				"gem",
+				"install",
+				"-N",
+				"rubygems-update",
+			}, " ")
+			if len(rubyGemsVersion) > 0 {
+				installRubyGemsUpdateSystemCmd = strings.Join([]string{
+					installRubyGemsUpdateSystemCmd,
+					"-v",
+					rubyGemsVersion,
+				}, " ")
+			}
+			_, err = bashcmd.RunBashCmd(installRubyGemsUpdateSystemCmd, context.WorkingDir)
+			if err != nil {
+				return packit.BuildResult{}, err
+			}
+
+			gemUpdateSystemCmd := strings.Join([]string{
+				"gem",
+				"update",
+				"-N",
+				"--system",
+				rubyGemsVersion,
+			}, " ")
+			_, err = bashcmd.RunBashCmd(gemUpdateSystemCmd, context.WorkingDir)
+			if err != nil {
+				return packit.BuildResult{}, err
+			}
+		}
+
+		gemCleanupCmd := strings.Join([]string{"gem", "cleanup"}, " ")
+		_, err = bashcmd.RunBashCmd(gemCleanupCmd, context.WorkingDir)
 		if err != nil {
 			return packit.BuildResult{}, err
 		}
@@ -199,15 +419,47 @@ func InstallBundler(context packit.BuildContext, configuration Configuration, lo
 			return packit.BuildResult{}, err
 		}
 
+		if generatedLockfile {
+			err = GenerateLockfile(context.WorkingDir, bashcmd, logger)
+			if err != nil {
+				return packit.BuildResult{}, err
+			}
+		}
+
+		if addPlatform && restoreLockfile == nil {
+			restoreLockfile, err = UseLockPlatform(context.WorkingDir, bundlerLayer.Path, platform, true, bashcmd, logger)
+			if err != nil {
+				return packit.BuildResult{}, err
+			}
+		}
+
 		bundleInstallCmd := strings.Join([]string{
 			"bundle",
 			"install",
 		}, " ")
+		if configuration.Standalone {
+			bundleInstallCmd = strings.Join([]string{
+				bundleInstallCmd,
+				"--standalone",
+			}, " ")
+		}
+
+		if caches.UseCcache {
+			err = EnableCcache(caches.Ccache, context.WorkingDir, bashcmd)
+			if err != nil {
+				return packit.BuildResult{}, err
+			}
+		}
+
 		_, err = bashcmd.RunBashCmd(bundleInstallCmd, context.WorkingDir)
 		if err != nil {
 			return packit.BuildResult{}, err
 		}
 
+		if caches.UseCcache {
+			ReportCcacheStats(context.WorkingDir, bashcmd, logger)
+		}
+
 		bundleCleanCmd := strings.Join([]string{
 			"bundle",
 			"clean",
@@ -217,44 +469,233 @@ func InstallBundler(context packit.BuildContext, configuration Configuration, lo
 			return packit.BuildResult{}, err
 		}
 
+		var resolvedGems []string
+		if generatedLockfile {
+			resolvedGems, err = ExportLockfile(context.WorkingDir, bundlerLayer.Path, logger)
+			if err != nil {
+				return packit.BuildResult{}, err
+			}
+
+			checksum, err = pristineChecksum(context.WorkingDir, pristineGemfile, calculator, HookPaths(context.WorkingDir, configuration)...)
+			if err != nil {
+				return packit.BuildResult{}, err
+			}
+		}
+
+		err = RunHook("post-bundle", configuration.PostBundleHook, context.WorkingDir, bashcmd, logger)
+		if err != nil {
+			return packit.BuildResult{}, err
+		}
+
+		err = installBinstubs(context, bundlerLayer, configuration, bundlerMajorVersion, bashcmd, logger)
+		if err != nil {
+			return packit.BuildResult{}, err
+		}
+
+		err = PruneBundle(bundlerLayer.Path, context.WorkingDir, configuration, bashcmd, logger)
+		if err != nil {
+			return packit.BuildResult{}, err
+		}
+
+		gemsManifest, err := GemsManifest(bundlerLayer.Path)
+		if err != nil {
+			return packit.BuildResult{}, err
+		}
+
 		bundlerLayer.Metadata = map[string]interface{}{
-			"version":      bundlerVersion(context, configuration),
-			"built_at":     clock.Now().Format(time.RFC3339Nano),
-			"cache_sha":    checksum,
-			"ruby_version": rubyVersion,
+			"version":       bundlerVersion(context, configuration),
+			"cache_sha":     checksum,
+			"ruby_version":  rubyVersionKey,
+			"gems_manifest": gemsManifest,
+		}
+
+		if len(options) > 0 {
+			bundlerLayer.Metadata["install_options"] = options
+		}
+
+		if generatedLockfile {
+			bundlerLayer.Metadata["resolved_gems"] = resolvedGems
+		}
+
+		if !configuration.Reproducible {
+			bundlerLayer.Metadata["built_at"] = clock.Now().Format(time.RFC3339Nano)
+		} else if sourceDateEpoch != nil {
+			bundlerLayer.Metadata["built_at"] = sourceDateEpoch.Format(time.RFC3339Nano)
 		}
 
 		timeDuration := clock.Now().Sub(timeStartInstall)
 		logger.Action("RVM Bundler CNB completed in %s", timeDuration.Round(time.Millisecond))
 		logger.Break()
-	} else {
-		logger.Process("Reusing cached layer %s", bundlerLayer.Path)
-		logger.Break()
+	}
 
-		err = configureBundlerPath(context, bundlerLayer, bundlerMajorVersion, bashcmd)
-		if err != nil {
-			return packit.BuildResult{}, err
-		}
+	err = VerifyBundle(context.WorkingDir, configuration, bashcmd, logger)
+	if err != nil {
+		return packit.BuildResult{}, err
 	}
 
 	bundlerLayer.BuildEnv.Default("BUNDLE_USER_CONFIG", filepath.Join(bundlerLayer.Path, "config"))
 	bundlerLayer.LaunchEnv.Default("BUNDLE_USER_CONFIG", filepath.Join(bundlerLayer.Path, "config"))
 
+	// A BUNDLE_GEMFILE set in the build environment isn't set at launch
+	if path, ok := os.LookupEnv("BUNDLE_GEMFILE"); ok && path != "" {
+		logger.Process("Using the Gemfile %s at launch", gemfile.Path)
+		bundlerLayer.LaunchEnv.Default("BUNDLE_GEMFILE", gemfile.Path)
+		logger.Break()
+	}
+
+	if configuration.Binstubs || configuration.Standalone {
+		bundlerLayer.BuildEnv.Prepend("PATH", filepath.Join(bundlerLayer.Path, "bin"), string(os.PathListSeparator))
+		bundlerLayer.LaunchEnv.Prepend("PATH", filepath.Join(bundlerLayer.Path, "bin"), string(os.PathListSeparator))
+	}
+
+	if configuration.Standalone && fileExists(filepath.Join(bundlerLayer.Path, "bundler", "setup.rb")) {
+		logger.Process("Using the standalone bundle at launch, processes run without 'bundle exec'")
+		bundlerLayer.LaunchEnv.Prepend("RUBYOPT", fmt.Sprintf("-r%s", filepath.Join(bundlerLayer.Path, "bundler", "setup")), " ")
+		logger.Break()
+	}
+
 	bundlerLayer.Build, bundlerLayer.Cache, bundlerLayer.Launch = true, true, true
 
 	buildResult := packit.BuildResult{
-		Layers: []packit.Layer{bundlerLayer},
+		Layers: []packit.Layer{bundlerLayer, caches.GemCache},
 		Build:  buildMetadata,
 		Launch: launchMetadata,
 	}
 
+	if caches.UseCcache {
+		buildResult.Layers = append(buildResult.Layers, caches.Ccache)
+	}
+
+	if caches.UseJars {
+		buildResult.Layers = append(buildResult.Layers, caches.Jars)
+	}
+
+	lock, err := ParseGemfileLock(gemfile.LockPath)
+	if err != nil && !os.IsNotExist(err) {
+		return packit.BuildResult{}, err
+	}
+
+	postInstallCacheLayer, ok, err := RunPostInstallTasks(context, bundle.LayerName("post-install-cache"), configuration, bashcmd, logger)
+	if err != nil {
+		return packit.BuildResult{}, err
+	}
+	if ok {
+		buildResult.Layers = append(buildResult.Layers, postInstallCacheLayer)
+	}
+
+	modificationTime := DefaultModificationTime
+	if sourceDateEpoch != nil {
+		modificationTime = *sourceDateEpoch
+	}
+
+	// Bootsnap keys its cache on the modification times of the sources, so
+	// the launch layers and the precompiled directories of the application
+	// are normalized before it precompiles them
+	if configuration.Reproducible {
+		logger.Process("Normalizing the launch layers for a reproducible build")
+		for _, layer := range buildResult.Layers {
+			if !layer.Launch {
+				continue
+			}
+
+			err = NormalizeLayer(layer.Path, modificationTime)
+			if err != nil {
+				return packit.BuildResult{}, err
+			}
+		}
+
+		if lock.Has("bootsnap") {
+			for _, dir := range bootsnapDirs {
+				err = normalizeModificationTimes(filepath.Join(context.WorkingDir, dir), modificationTime)
+				if err != nil {
+					return packit.BuildResult{}, err
+				}
+			}
+		}
+		logger.Break()
+	}
+
+	bootsnapLayer, ok, err := PrecompileBootsnap(context, bundle.LayerName("bootsnap"), lock, checksum, bashcmd, logger)
+	if err != nil {
+		return packit.BuildResult{}, err
+	}
+	if ok {
+		if configuration.Reproducible {
+			err = NormalizeLayer(bootsnapLayer.Path, modificationTime)
+			if err != nil {
+				return packit.BuildResult{}, err
+			}
+		}
+
+		buildResult.Layers = append(buildResult.Layers, bootsnapLayer)
+	}
+
+	webServer, err := SelectWebServer(context.WorkingDir, configuration)
+	if err != nil {
+		return packit.BuildResult{}, err
+	}
+
+	err = ConfigureWebServer(context.WorkingDir, webServer, configuration, logger)
+	if err != nil {
+		return packit.BuildResult{}, err
+	}
+
+	procfileProcesses, err := ParseProcfile(filepath.Join(context.WorkingDir, "Procfile"))
+	if err != nil && !os.IsNotExist(err) {
+		return packit.BuildResult{}, err
+	}
+
+	for _, process := range procfileProcesses {
+		logger.Process("Returning process type '%s' from Procfile with command '%s'", process.Type, process.Command)
+		buildResult.Launch.Processes = append(buildResult.Launch.Processes, process)
+	}
+
 	pumaProcess, err := pumainstaller.CreatePumaProcess(context, configuration, logger)
 	if err == nil && pumaProcess.Type == "web" && pumaProcess.Command != "" {
 		buildResult.Launch.Processes = append(buildResult.Launch.Processes, pumaProcess)
 	}
+
+	for _, inferred := range InferProcesses(context.WorkingDir, lock, configuration) {
+		if hasProcess(buildResult.Launch.Processes, inferred.Type) {
+			continue
+		}
+
+		logger.Process("Returning process type '%s' with command '%s' (%s)", inferred.Type, inferred.Command, inferred.Reason)
+		buildResult.Launch.Processes = append(buildResult.Launch.Processes, inferred.Process)
+	}
+
+	if len(buildResult.Launch.Processes) > 0 && !SetDefaultProcess(buildResult.Launch.Processes, configuration.DefaultProcess) {
+		logger.Process("No process of type '%s' to use as the default process", configuration.DefaultProcess)
+	}
+	logger.Break()
+
+	scopeProcesses(&buildResult, bundle, appDir, bundlerLayer.Name, bundle.LayerName("bootsnap"))
+
+	if restoreLockfile != nil {
+		restore := restoreLockfile
+		restoreLockfile = nil
+
+		err = restore()
+		if err != nil {
+			return packit.BuildResult{}, err
+		}
+	}
+
 	return buildResult, nil
 }
 
+// parseBundlerMajorVersion returns the major version of the Bundler version
+// to install
+func parseBundlerMajorVersion(context packit.BuildContext, configuration Configuration, logger scribe.Logger) (int, error) {
+	majorVersion, err := strconv.Atoi(bundlerVersion(context, configuration)[:1])
+	if err != nil {
+		logger.Process("Failed to determine bundler major version")
+		return 0, err
+	}
+
+	return majorVersion, nil
+}
+
 func bundlerVersion(context packit.BuildContext, configuration Configuration) string {
 	bundlerVersion := configuration.DefaultBundlerVersion
 	for _, entry := range context.Plan.Entries {
@@ -280,43 +721,90 @@ func configureBundlerPath(context packit.BuildContext, bundlerLayer packit.Layer
 	return nil
 }
 
+// installBinstubs writes a binstub for every executable of the bundle into the
+// bin directory of the bundler layer. The directory is recreated from scratch
+// so that binstubs of removed gems don't linger in the cached layer. The
+// binstubs are required by the standalone mode.
+func installBinstubs(context packit.BuildContext, bundlerLayer packit.Layer, configuration Configuration, bundlerMajorVersion int, bashcmd BashCmd, logger scribe.Logger) error {
+	if !configuration.Binstubs && !configuration.Standalone {
+		return nil
+	}
+
+	binPath := filepath.Join(bundlerLayer.Path, "bin")
+	err := os.RemoveAll(binPath)
+	if err != nil {
+		return err
+	}
+
+	if bundlerMajorVersion < 2 {
+		logger.Process("Skipping binstubs because 'bundle binstubs --all' requires Bundler 2 or later")
+		return nil
+	}
+
+	logger.Process("Writing binstubs to %s", binPath)
+
+	cmdComponents := []string{"bundle", "binstubs", "--all"}
+	if configuration.Standalone {
+		cmdComponents = append(cmdComponents, "--standalone")
+	}
+	cmdComponents = append(cmdComponents, "--path", binPath)
+	_, err = bashcmd.RunBashCmd(strings.Join(cmdComponents, " "), context.WorkingDir)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// binstubsMissing reports whether binstubs are enabled but the bin directory
+// of the bundler layer is missing or empty, e.g. for a layer cached before
+// binstubs were enabled
+func binstubsMissing(layerPath string, configuration Configuration) bool {
+	if !configuration.Binstubs && !configuration.Standalone {
+		return false
+	}
+
+	entries, err := os.ReadDir(filepath.Join(layerPath, "bin"))
+	return err != nil || len(entries) == 0
+}
+
 // ShouldRun will return true if it is determined that the BundleInstallProcess
 // be executed during the build phase.
 //
 // The criteria for determining that the install process should be executed is
-// if the major or minor version of Ruby has changed, or if the contents of the
-// Gemfile or Gemfile.lock have changed.
+// if the version of Ruby has changed with the given cache key sensitivity, by
+// default the major or minor version, or if the contents of the Gemfile and
+// its lockfile as found by FindGemfile, e.g. gems.rb and gems.locked, or any
+// of the given fingerprint paths, e.g. the pre- and post-bundle hooks, have
+// changed.
 //
 // In addition to reporting if the install process should execute, this method
-// will return the current version of Ruby and the checksum of the Gemfile and
-// Gemfile.lock contents.
-func ShouldRun(metadata map[string]interface{}, workingDir string, versionResolver VersionResolver, calculator Calculator, bashcmd BashCmd) (bool, string, string, error) {
+// will return the current version of Ruby and the checksum of the Gemfile,
+// Gemfile.lock and fingerprint paths contents.
+func ShouldRun(metadata map[string]interface{}, workingDir string, sensitivity string, versionResolver VersionResolver, calculator Calculator, bashcmd BashCmd, fingerprintPaths ...string) (bool, string, RubyVersion, error) {
 
 	rubyVersion, err := versionResolver.Lookup(workingDir, bashcmd)
 	if err != nil {
-		return false, "", "", err
+		return false, "", RubyVersion{}, err
+	}
+
+	rubyVersionKey, err := rubyVersion.CacheKey(sensitivity)
+	if err != nil {
+		return false, "", RubyVersion{}, err
 	}
 
 	cachedRubyVersion, ok := metadata["ruby_version"].(string)
 	rubyVersionMatch := true
 
 	if ok {
-		if cachedRubyVersion != rubyVersion {
+		if cachedRubyVersion != rubyVersionKey {
 			rubyVersionMatch = false
 		}
 	}
 
-	var sum string
-	_, err = os.Stat(filepath.Join(workingDir, "Gemfile.lock"))
+	sum, err := lockfileChecksum(workingDir, calculator, fingerprintPaths...)
 	if err != nil {
-		if !os.IsNotExist(err) {
-			return false, "", "", err
-		}
-	} else {
-		sum, err = calculator.Sum(filepath.Join(workingDir, "Gemfile"), filepath.Join(workingDir, "Gemfile.lock"))
-		if err != nil {
-			return false, "", "", err
-		}
+		return false, "", RubyVersion{}, err
 	}
 
 	cachedSHA, ok := metadata["cache_sha"].(string)
@@ -326,20 +814,140 @@ func ShouldRun(metadata map[string]interface{}, workingDir string, versionResolv
 	return shouldRun, sum, rubyVersion, nil
 }
 
-// Extracts major ruby version from a substring like "ruby-1.2.3" or "ruby-head" from "^ruby" and "^jruby" strings
-// Returns major + minor versions OR "head" + "" and an error.
-func extractRubyVersion(version string) (string, string, error) {
-	re := regexp.MustCompile(`ruby-(\d+)\.(\d+)`)
-	matches := re.FindStringSubmatch(version)
+// lockfileChecksum returns the checksum of the application's Gemfile, its
+// lockfile and the given fingerprint paths, or an empty string if there is no
+// lockfile
+func lockfileChecksum(workingDir string, calculator Calculator, fingerprintPaths ...string) (string, error) {
+	gemfile := FindGemfile(workingDir)
+
+	_, err := os.Stat(gemfile.LockPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", err
+	}
+
+	paths := append([]string{gemfile.Path, gemfile.LockPath}, fingerprintPaths...)
+	return calculator.Sum(paths...)
+}
+
+// pristineChecksum returns the lockfileChecksum of the application with the
+// given contents of the Gemfile as checked out, before Puma has been added to
+// it, so that it matches the checksum computed by the next build
+func pristineChecksum(workingDir string, pristine []byte, calculator Calculator, fingerprintPaths ...string) (string, error) {
+	path := FindGemfile(workingDir).Path
+
+	info, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return lockfileChecksum(workingDir, calculator, fingerprintPaths...)
+		}
+		return "", err
+	}
+
+	patched, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	if bytes.Equal(patched, pristine) {
+		return lockfileChecksum(workingDir, calculator, fingerprintPaths...)
+	}
+
+	err = os.WriteFile(path, pristine, info.Mode())
+	if err != nil {
+		return "", err
+	}
+
+	sum, sumErr := lockfileChecksum(workingDir, calculator, fingerprintPaths...)
+
+	err = os.WriteFile(path, patched, info.Mode())
+	if err != nil {
+		return "", err
+	}
+
+	return sum, sumErr
+}
+
+// installOptions returns the options of the configuration the bundle is
+// installed with, which are recorded in the layer metadata. Options that are
+// disabled are left out, so that layers of builds that didn't record them
+// match.
+func installOptions(configuration Configuration) map[string]string {
+	options := map[string]string{}
+	if configuration.Standalone {
+		options["standalone"] = "true"
+	}
+
+	if configuration.Prune {
+		options["prune"] = "true"
+		options["prune_patterns"] = strings.Join(configuration.PrunePatterns, " ")
+		options["prune_keep"] = strings.Join(configuration.PruneKeep, " ")
+	}
+
+	if configuration.StripDebug {
+		options["strip_debug"] = "true"
+	}
+
+	return options
+}
+
+// changedInstallOption returns the name of an install option that differs
+// from the options recorded in the layer metadata, or an empty string if the
+// bundle has been installed with the same options
+func changedInstallOption(metadata map[string]interface{}, options map[string]string) string {
+	cached := map[string]string{}
+	switch recorded := metadata["install_options"].(type) {
+	case map[string]interface{}:
+		for name, value := range recorded {
+			if s, ok := value.(string); ok {
+				cached[name] = s
+			}
+		}
+	case map[string]string:
+		cached = recorded
+	}
+
+	names := []string{}
+	for name := range options {
+		names = append(names, name)
+	}
+	for name := range cached {
+		if _, ok := options[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
 
-	if len(matches) < 2 {
-		if strings.Contains(version, "ruby-head") {
-			return "head", "", nil
+	for _, name := range names {
+		if cached[name] != options[name] {
+			return name
 		}
-		return "", "", fmt.Errorf("unable to extract Ruby version from: %s", version)
 	}
 
-	return matches[1], matches[2], nil
+	return ""
+}
+
+// bundleExec returns the given command prefixed with "bundle exec" unless the
+// bundle is installed in standalone mode
+func bundleExec(configuration Configuration, command string) string {
+	if configuration.Standalone {
+		return command
+	}
+
+	return fmt.Sprintf("bundle exec %s", command)
+}
+
+// hasProcess checks if a process of the given type is present in a slice
+func hasProcess(processes []packit.Process, processType string) bool {
+	for _, process := range processes {
+		if process.Type == processType {
+			return true
+		}
+	}
+
+	return false
 }
 
 // contains checks if a string is present in a slice
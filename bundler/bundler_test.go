@@ -3,14 +3,17 @@ package bundler_test
 import (
 	"bytes"
 	"errors"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	bundler "github.com/avarteqgmbh/rvm-bundler-cnb/bundler"
 	"github.com/avarteqgmbh/rvm-bundler-cnb/bundler/fakes"
 	"github.com/paketo-buildpacks/packit/v2"
+	"github.com/paketo-buildpacks/packit/v2/fs"
 	"github.com/paketo-buildpacks/packit/v2/scribe"
 	"github.com/sclevine/spec"
 
@@ -66,7 +69,7 @@ func testBundler(t *testing.T, context spec.G, it spec.S) {
 
 	context("InstallBunler", func() {
 		it.Before(func() {
-			versionResolver.LookupCall.Returns.Version = "ruby-3.3.0"
+			versionResolver.LookupCall.Returns.Version = bundler.RubyVersion{Engine: "ruby", Major: 3, Minor: 3, Patch: 0}
 			calculator.SumCall.Returns.String = "other-checksum"
 			Expect(os.WriteFile(filepath.Join(workingDir, "Gemfile.lock"), nil, 0600)).To(Succeed())
 		})
@@ -104,6 +107,1099 @@ func testBundler(t *testing.T, context spec.G, it spec.S) {
 			Expect(err).NotTo(HaveOccurred())
 		})
 
+		it("runs the hooks around bundle install", func() {
+			Expect(os.MkdirAll(filepath.Join(workingDir, "bin"), os.ModePerm)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(workingDir, "bin", "pre-bundle"), nil, 0755)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(workingDir, "bin", "post-bundle"), nil, 0755)).To(Succeed())
+
+			preHook := fmt.Sprintf("'%s'", filepath.Join(workingDir, "bin", "pre-bundle"))
+			postHook := fmt.Sprintf("'%s'", filepath.Join(workingDir, "bin", "post-bundle"))
+
+			var order []string
+			bashCmd.RunBashCmdCall.Stub = func(command string, dir string) (string, error) {
+				switch command {
+				case preHook, postHook, "bundle install":
+					order = append(order, command)
+				}
+				return "", nil
+			}
+
+			ctx = packit.BuildContext{
+				WorkingDir: workingDir,
+				CNBPath:    cnbDir,
+				Stack:      "some-stack",
+				Layers:     packit.Layers{Path: layersDir},
+			}
+
+			buffer = bytes.NewBuffer(nil)
+			logger := scribe.NewLogger(buffer)
+			configuration, _ := bundler.ReadConfiguration(ctx.CNBPath)
+			configuration.InstallPuma = false
+			configuration.PreBundleHook = "bin/pre-bundle"
+			configuration.PostBundleHook = "bin/post-bundle"
+
+			_, err := bundler.InstallBundler(ctx, configuration, logger, versionResolver, calculator, bashCmd, pumainstaller)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(order).To(Equal([]string{preHook, "bundle install", postHook}))
+			Expect(buffer.String()).To(MatchRegexp(`(?s)Running pre-bundle hook 'bin/pre-bundle'\n.*Completed in .*Installing Bundler version.*Running post-bundle hook 'bin/post-bundle'\n.*Completed in `))
+		})
+
+		it("returns the processes of the Procfile and marks the configured default process", func() {
+			procfile := "web: bundle exec puma\nworker: bundle exec sidekiq\n"
+			Expect(os.WriteFile(filepath.Join(workingDir, "Procfile"), []byte(procfile), 0644)).To(Succeed())
+
+			ctx = packit.BuildContext{
+				WorkingDir: workingDir,
+				CNBPath:    cnbDir,
+				Stack:      "some-stack",
+				Layers:     packit.Layers{Path: layersDir},
+				BuildpackInfo: packit.BuildpackInfo{
+					Name:    "Some Buildpack",
+					Version: "1.2.3",
+				},
+			}
+
+			buffer = bytes.NewBuffer(nil)
+			logger := scribe.NewLogger(buffer)
+			configuration, _ := bundler.ReadConfiguration(ctx.CNBPath)
+			configuration.InstallPuma = false
+			configuration.DefaultProcess = "worker"
+
+			result, err := bundler.InstallBundler(ctx, configuration, logger, versionResolver, calculator, bashCmd, pumainstaller)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Launch.Processes).To(Equal([]packit.Process{
+				{Type: "web", Command: "bundle exec puma"},
+				{Type: "worker", Command: "bundle exec sidekiq", Default: true},
+			}))
+		})
+
+		it("returns the processes inferred from the application in addition to the Procfile ones", func() {
+			Expect(os.WriteFile(filepath.Join(workingDir, "Procfile"), []byte("worker: bin/worker\n"), 0644)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(workingDir, "Rakefile"), nil, 0644)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(workingDir, "Gemfile.lock"), []byte("GEM\n  specs:\n    sidekiq (6.5.1)\n"), 0644)).To(Succeed())
+
+			ctx = packit.BuildContext{
+				WorkingDir: workingDir,
+				CNBPath:    cnbDir,
+				Stack:      "some-stack",
+				Layers:     packit.Layers{Path: layersDir},
+				BuildpackInfo: packit.BuildpackInfo{
+					Name:    "Some Buildpack",
+					Version: "1.2.3",
+				},
+			}
+
+			buffer = bytes.NewBuffer(nil)
+			logger := scribe.NewLogger(buffer)
+			configuration, _ := bundler.ReadConfiguration(ctx.CNBPath)
+			configuration.InstallPuma = false
+
+			result, err := bundler.InstallBundler(ctx, configuration, logger, versionResolver, calculator, bashCmd, pumainstaller)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Launch.Processes).To(Equal([]packit.Process{
+				{Type: "worker", Command: "bin/worker"},
+				{Type: "rake", Command: "bundle exec rake"},
+			}))
+			Expect(buffer.String()).To(ContainSubstring("Returning process type 'rake' with command 'bundle exec rake' (Rakefile found)"))
+		})
+
+		context("when the cached layer can be reused", func() {
+			var commands []string
+
+			it.Before(func() {
+				commands = nil
+				bashCmd.RunBashCmdCall.Stub = func(command string, workingDir string) (string, error) {
+					commands = append(commands, command)
+					return "", nil
+				}
+
+				layerPath := filepath.Join(layersDir, "rvm-bundler")
+				Expect(os.MkdirAll(filepath.Join(layerPath, "ruby", "3.3.0", "gems", "rack-2.2.4"), os.ModePerm)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(layersDir, "rvm-bundler.toml"), []byte(`[metadata]
+cache_sha = "other-checksum"
+ruby_version = "ruby-3.3"
+gems_manifest = ["ruby/3.3.0/gems/rack-2.2.4"]
+`), 0644)).To(Succeed())
+
+				ctx = packit.BuildContext{
+					WorkingDir: workingDir,
+					CNBPath:    cnbDir,
+					Stack:      "some-stack",
+					Layers:     packit.Layers{Path: layersDir},
+					BuildpackInfo: packit.BuildpackInfo{
+						Name:    "Some Buildpack",
+						Version: "1.2.3",
+					},
+				}
+			})
+
+			it("reuses the layer if it passes the integrity check", func() {
+				buffer = bytes.NewBuffer(nil)
+				logger := scribe.NewLogger(buffer)
+				configuration, _ := bundler.ReadConfiguration(ctx.CNBPath)
+				configuration.InstallPuma = false
+
+				_, err := bundler.InstallBundler(ctx, configuration, logger, versionResolver, calculator, bashCmd, pumainstaller)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(commands).To(ContainElement("bundle check"))
+				Expect(commands).NotTo(ContainElement("bundle install"))
+				Expect(buffer.String()).To(ContainSubstring("Reusing cached layer"))
+			})
+
+			it("runs the pre-bundle hook before checking the cached layer", func() {
+				Expect(os.MkdirAll(filepath.Join(workingDir, "bin"), os.ModePerm)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(workingDir, "bin", "pre-bundle"), nil, 0755)).To(Succeed())
+
+				buffer = bytes.NewBuffer(nil)
+				logger := scribe.NewLogger(buffer)
+				configuration, _ := bundler.ReadConfiguration(ctx.CNBPath)
+				configuration.InstallPuma = false
+				configuration.PreBundleHook = "bin/pre-bundle"
+
+				_, err := bundler.InstallBundler(ctx, configuration, logger, versionResolver, calculator, bashCmd, pumainstaller)
+				Expect(err).NotTo(HaveOccurred())
+
+				hook := fmt.Sprintf("'%s'", filepath.Join(workingDir, "bin", "pre-bundle"))
+				var order []string
+				for _, command := range commands {
+					if command == hook || command == "bundle check" {
+						order = append(order, command)
+					}
+				}
+				Expect(order).To(Equal([]string{hook, "bundle check"}))
+				Expect(buffer.String()).To(ContainSubstring("Running pre-bundle hook 'bin/pre-bundle'"))
+				Expect(buffer.String()).To(ContainSubstring("Reusing cached layer"))
+			})
+
+			it("reinstalls the bundle from scratch if the prune options changed", func() {
+				layerPath := filepath.Join(layersDir, "rvm-bundler")
+
+				buffer = bytes.NewBuffer(nil)
+				logger := scribe.NewLogger(buffer)
+				configuration, _ := bundler.ReadConfiguration(ctx.CNBPath)
+				configuration.InstallPuma = false
+				configuration.Prune = true
+				configuration.PrunePatterns = []string{"doc"}
+
+				result, err := bundler.InstallBundler(ctx, configuration, logger, versionResolver, calculator, bashCmd, pumainstaller)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(buffer.String()).To(ContainSubstring("The option 'prune' changed, reinstalling the bundle from scratch"))
+				Expect(filepath.Join(layerPath, "ruby")).NotTo(BeADirectory())
+				Expect(commands).To(ContainElement("bundle install"))
+				Expect(result.Layers[0].Metadata).To(HaveKeyWithValue("install_options", map[string]string{
+					"prune":          "true",
+					"prune_patterns": "doc",
+					"prune_keep":     "",
+				}))
+			})
+
+			it("reuses the layer if the recorded options didn't change", func() {
+				Expect(os.WriteFile(filepath.Join(layersDir, "rvm-bundler.toml"), []byte(`[metadata]
+cache_sha = "other-checksum"
+ruby_version = "ruby-3.3"
+gems_manifest = ["ruby/3.3.0/gems/rack-2.2.4"]
+[metadata.install_options]
+prune = "true"
+prune_patterns = "doc"
+prune_keep = ""
+`), 0644)).To(Succeed())
+
+				buffer = bytes.NewBuffer(nil)
+				logger := scribe.NewLogger(buffer)
+				configuration, _ := bundler.ReadConfiguration(ctx.CNBPath)
+				configuration.InstallPuma = false
+				configuration.Prune = true
+				configuration.PrunePatterns = []string{"doc"}
+
+				_, err := bundler.InstallBundler(ctx, configuration, logger, versionResolver, calculator, bashCmd, pumainstaller)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(commands).NotTo(ContainElement("bundle install"))
+				Expect(buffer.String()).To(ContainSubstring("Reusing cached layer"))
+
+				configuration.PruneKeep = []string{"gems/nokogiri-*/ext"}
+
+				_, err = bundler.InstallBundler(ctx, configuration, logger, versionResolver, calculator, bashCmd, pumainstaller)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(buffer.String()).To(ContainSubstring("The option 'prune_keep' changed"))
+				Expect(commands).To(ContainElement("bundle install"))
+			})
+
+			it("writes the binstubs missing from the cached layer", func() {
+				layerPath := filepath.Join(layersDir, "rvm-bundler")
+
+				buffer = bytes.NewBuffer(nil)
+				logger := scribe.NewLogger(buffer)
+				configuration, _ := bundler.ReadConfiguration(ctx.CNBPath)
+				configuration.InstallPuma = false
+				configuration.Binstubs = true
+
+				_, err := bundler.InstallBundler(ctx, configuration, logger, versionResolver, calculator, bashCmd, pumainstaller)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(commands).NotTo(ContainElement("bundle install"))
+				Expect(commands).To(ContainElement(fmt.Sprintf("bundle binstubs --all --path %s", filepath.Join(layerPath, "bin"))))
+				Expect(buffer.String()).To(ContainSubstring("Writing the binstubs missing from the cached layer"))
+			})
+
+			it("keeps the binstubs of the cached layer", func() {
+				layerPath := filepath.Join(layersDir, "rvm-bundler")
+				Expect(os.MkdirAll(filepath.Join(layerPath, "bin"), os.ModePerm)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(layerPath, "bin", "rackup"), nil, 0755)).To(Succeed())
+
+				buffer = bytes.NewBuffer(nil)
+				logger := scribe.NewLogger(buffer)
+				configuration, _ := bundler.ReadConfiguration(ctx.CNBPath)
+				configuration.InstallPuma = false
+				configuration.Binstubs = true
+
+				_, err := bundler.InstallBundler(ctx, configuration, logger, versionResolver, calculator, bashCmd, pumainstaller)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(commands).NotTo(ContainElement(ContainSubstring("bundle binstubs")))
+				Expect(filepath.Join(layerPath, "bin", "rackup")).To(BeAnExistingFile())
+			})
+
+			it("reinstalls the bundle if the layer fails the integrity check", func() {
+				layerPath := filepath.Join(layersDir, "rvm-bundler")
+				Expect(os.RemoveAll(filepath.Join(layerPath, "ruby", "3.3.0", "gems", "rack-2.2.4"))).To(Succeed())
+
+				buffer = bytes.NewBuffer(nil)
+				logger := scribe.NewLogger(buffer)
+				configuration, _ := bundler.ReadConfiguration(ctx.CNBPath)
+				configuration.InstallPuma = false
+
+				_, err := bundler.InstallBundler(ctx, configuration, logger, versionResolver, calculator, bashCmd, pumainstaller)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(commands).To(ContainElement("bundle install"))
+				Expect(buffer.String()).To(ContainSubstring("Cached layer failed the integrity check: gem directories are missing: ruby/3.3.0/gems/rack-2.2.4"))
+				Expect(filepath.Join(layerPath, "ruby")).NotTo(BeADirectory())
+			})
+		})
+
+		context("when the Ruby version changed", func() {
+			it.Before(func() {
+				layerPath := filepath.Join(layersDir, "rvm-bundler")
+				Expect(os.MkdirAll(filepath.Join(layerPath, "ruby", "3.2.0", "gems", "rack-2.2.4"), os.ModePerm)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(layerPath, "config"), nil, 0644)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(layersDir, "rvm-bundler.toml"), []byte(`[metadata]
+cache_sha = "other-checksum"
+ruby_version = "ruby-3.2"
+`), 0644)).To(Succeed())
+
+				ctx = packit.BuildContext{
+					WorkingDir: workingDir,
+					CNBPath:    cnbDir,
+					Stack:      "some-stack",
+					Layers:     packit.Layers{Path: layersDir},
+					BuildpackInfo: packit.BuildpackInfo{
+						Name:    "Some Buildpack",
+						Version: "1.2.3",
+					},
+				}
+			})
+
+			it("removes the gems of the old Ruby ABI and keeps the gem download cache", func() {
+				buffer = bytes.NewBuffer(nil)
+				logger := scribe.NewLogger(buffer)
+				configuration, _ := bundler.ReadConfiguration(ctx.CNBPath)
+				configuration.InstallPuma = false
+
+				result, err := bundler.InstallBundler(ctx, configuration, logger, versionResolver, calculator, bashCmd, pumainstaller)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(filepath.Join(layersDir, "rvm-bundler", "ruby", "3.2.0")).NotTo(BeADirectory())
+				Expect(buffer.String()).To(ContainSubstring("Ruby changed from 'ruby-3.2' to 'ruby-3.3'"))
+
+				gemCacheLayer := result.Layers[1]
+				Expect(gemCacheLayer.Name).To(Equal("gem-cache"))
+				Expect(gemCacheLayer.Cache).To(BeTrue())
+				Expect(gemCacheLayer.Launch).To(BeFalse())
+				Expect(os.Getenv("BUNDLE_USER_CACHE")).To(Equal(gemCacheLayer.Path))
+				Expect(os.Getenv("BUNDLE_GLOBAL_GEM_CACHE")).To(Equal("true"))
+			})
+		})
+
+		context("when binstubs are enabled", func() {
+			var commands []string
+
+			it.Before(func() {
+				commands = nil
+				bashCmd.RunBashCmdCall.Stub = func(command string, workingDir string) (string, error) {
+					commands = append(commands, command)
+					return "", nil
+				}
+
+				ctx = packit.BuildContext{
+					WorkingDir: workingDir,
+					CNBPath:    cnbDir,
+					Stack:      "some-stack",
+					Layers:     packit.Layers{Path: layersDir},
+					BuildpackInfo: packit.BuildpackInfo{
+						Name:    "Some Buildpack",
+						Version: "1.2.3",
+					},
+				}
+			})
+
+			it("writes the binstubs into the layer and puts them on the PATH", func() {
+				layerPath := filepath.Join(layersDir, "rvm-bundler")
+				Expect(os.MkdirAll(filepath.Join(layerPath, "bin"), os.ModePerm)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(layerPath, "bin", "removed-gem"), nil, 0755)).To(Succeed())
+
+				buffer = bytes.NewBuffer(nil)
+				logger := scribe.NewLogger(buffer)
+				configuration, _ := bundler.ReadConfiguration(ctx.CNBPath)
+				configuration.InstallPuma = false
+				configuration.Binstubs = true
+
+				result, err := bundler.InstallBundler(ctx, configuration, logger, versionResolver, calculator, bashCmd, pumainstaller)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(commands).To(ContainElement(fmt.Sprintf("bundle binstubs --all --path %s", filepath.Join(layerPath, "bin"))))
+				Expect(filepath.Join(layerPath, "bin", "removed-gem")).NotTo(BeAnExistingFile())
+
+				layer := result.Layers[0]
+				Expect(layer.BuildEnv).To(HaveKeyWithValue("PATH.prepend", filepath.Join(layerPath, "bin")))
+				Expect(layer.LaunchEnv).To(HaveKeyWithValue("PATH.prepend", filepath.Join(layerPath, "bin")))
+			})
+
+			it("skips the binstubs for Bundler 1", func() {
+				buffer = bytes.NewBuffer(nil)
+				logger := scribe.NewLogger(buffer)
+				configuration, _ := bundler.ReadConfiguration(ctx.CNBPath)
+				configuration.InstallPuma = false
+				configuration.DefaultBundlerVersion = "1.17.3"
+				configuration.Binstubs = true
+
+				_, err := bundler.InstallBundler(ctx, configuration, logger, versionResolver, calculator, bashCmd, pumainstaller)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(commands).NotTo(ContainElement(ContainSubstring("bundle binstubs")))
+				Expect(buffer.String()).To(ContainSubstring("Skipping binstubs"))
+			})
+		})
+
+		context("when the standalone mode is enabled", func() {
+			var commands []string
+
+			it.Before(func() {
+				commands = nil
+				bashCmd.RunBashCmdCall.Stub = func(command string, workingDir string) (string, error) {
+					commands = append(commands, command)
+					return "", nil
+				}
+
+				ctx = packit.BuildContext{
+					WorkingDir: workingDir,
+					CNBPath:    cnbDir,
+					Stack:      "some-stack",
+					Layers:     packit.Layers{Path: layersDir},
+					BuildpackInfo: packit.BuildpackInfo{
+						Name:    "Some Buildpack",
+						Version: "1.2.3",
+					},
+				}
+			})
+
+			it("installs a standalone bundle and drops 'bundle exec' at launch", func() {
+				bashCmd.RunBashCmdCall.Stub = func(command string, workingDir string) (string, error) {
+					commands = append(commands, command)
+					if command == "bundle install --standalone" {
+						Expect(os.MkdirAll(filepath.Join(layersDir, "rvm-bundler", "bundler"), os.ModePerm)).To(Succeed())
+						Expect(os.WriteFile(filepath.Join(layersDir, "rvm-bundler", "bundler", "setup.rb"), nil, 0644)).To(Succeed())
+					}
+					return "", nil
+				}
+
+				buffer = bytes.NewBuffer(nil)
+				logger := scribe.NewLogger(buffer)
+				configuration, _ := bundler.ReadConfiguration(ctx.CNBPath)
+				configuration.InstallPuma = false
+				configuration.Standalone = true
+
+				Expect(os.WriteFile(filepath.Join(workingDir, "Rakefile"), nil, 0644)).To(Succeed())
+
+				result, err := bundler.InstallBundler(ctx, configuration, logger, versionResolver, calculator, bashCmd, pumainstaller)
+				Expect(err).NotTo(HaveOccurred())
+
+				layerPath := filepath.Join(layersDir, "rvm-bundler")
+				Expect(commands).To(ContainElements(
+					"bundle install --standalone",
+					fmt.Sprintf("bundle binstubs --all --standalone --path %s", filepath.Join(layerPath, "bin")),
+				))
+
+				layer := result.Layers[0]
+				Expect(layer.LaunchEnv).To(HaveKeyWithValue("RUBYOPT.prepend", fmt.Sprintf("-r%s", filepath.Join(layerPath, "bundler", "setup"))))
+				Expect(layer.LaunchEnv).To(HaveKeyWithValue("PATH.prepend", filepath.Join(layerPath, "bin")))
+				Expect(result.Launch.Processes).To(Equal([]packit.Process{
+					{Type: "rake", Command: "rake"},
+				}))
+				Expect(layer.Metadata).To(HaveKeyWithValue("install_options", map[string]string{"standalone": "true"}))
+			})
+
+			it("reinstalls a cached bundle that hasn't been installed standalone", func() {
+				layerPath := filepath.Join(layersDir, "rvm-bundler")
+				Expect(os.MkdirAll(filepath.Join(layerPath, "ruby", "3.3.0", "gems", "rack-2.2.4"), os.ModePerm)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(layersDir, "rvm-bundler.toml"), []byte(`[metadata]
+cache_sha = "other-checksum"
+ruby_version = "ruby-3.3"
+gems_manifest = ["ruby/3.3.0/gems/rack-2.2.4"]
+`), 0644)).To(Succeed())
+
+				buffer = bytes.NewBuffer(nil)
+				logger := scribe.NewLogger(buffer)
+				configuration, _ := bundler.ReadConfiguration(ctx.CNBPath)
+				configuration.InstallPuma = false
+				configuration.Standalone = true
+
+				result, err := bundler.InstallBundler(ctx, configuration, logger, versionResolver, calculator, bashCmd, pumainstaller)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(buffer.String()).To(ContainSubstring("The option 'standalone' changed, reinstalling the bundle"))
+				Expect(commands).To(ContainElement("bundle install --standalone"))
+				Expect(result.Layers[0].LaunchEnv).NotTo(HaveKey("RUBYOPT.prepend"))
+			})
+
+			it("returns an error for Bundler 1", func() {
+				buffer = bytes.NewBuffer(nil)
+				logger := scribe.NewLogger(buffer)
+				configuration, _ := bundler.ReadConfiguration(ctx.CNBPath)
+				configuration.DefaultBundlerVersion = "1.17.3"
+				configuration.Standalone = true
+
+				_, err := bundler.InstallBundler(ctx, configuration, logger, versionResolver, calculator, bashCmd, pumainstaller)
+				Expect(err).To(MatchError("bundler standalone mode requires Bundler 2 or later, got 1.17.3"))
+			})
+		})
+
+		context("when running on JRuby, TruffleRuby or ruby-head", func() {
+			var commands []string
+
+			it.Before(func() {
+				versionResolver.LookupCall.Returns.Version = bundler.RubyVersion{Engine: "jruby", Major: 9, Minor: 4, Patch: 3}
+
+				commands = nil
+				bashCmd.RunBashCmdCall.Stub = func(command string, workingDir string) (string, error) {
+					commands = append(commands, command)
+					return "", nil
+				}
+
+				lock := "GEM\n  remote: https://rubygems.org/\n  specs:\n    rack (2.2.4)\n\nPLATFORMS\n  x86_64-linux\n\nDEPENDENCIES\n  rack\n"
+				Expect(os.WriteFile(filepath.Join(workingDir, "Gemfile.lock"), []byte(lock), 0600)).To(Succeed())
+
+				ctx = packit.BuildContext{
+					WorkingDir: workingDir,
+					CNBPath:    cnbDir,
+					Stack:      "some-stack",
+					Layers:     packit.Layers{Path: layersDir},
+					BuildpackInfo: packit.BuildpackInfo{
+						Name:    "Some Buildpack",
+						Version: "1.2.3",
+					},
+				}
+			})
+
+			it.After(func() {
+				os.Unsetenv("JARS_HOME")
+			})
+
+			it("keeps the bundled RubyGems, runs Puma without workers and caches the jars", func() {
+				buffer = bytes.NewBuffer(nil)
+				logger := scribe.NewLogger(buffer)
+				configuration, _ := bundler.ReadConfiguration(ctx.CNBPath)
+
+				result, err := bundler.InstallBundler(ctx, configuration, logger, versionResolver, calculator, bashCmd, pumainstaller)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(commands).NotTo(ContainElement(ContainSubstring("--system")))
+				Expect(commands).NotTo(ContainElement(ContainSubstring("rubygems-update")))
+				Expect(commands).To(ContainElement("bundle install"))
+				Expect(buffer.String()).To(ContainSubstring("Keeping the RubyGems version bundled with jruby-9.4.3"))
+				Expect(buffer.String()).To(ContainSubstring("Gemfile.lock doesn't contain the 'java' platform"))
+
+				Expect(pumainstaller.InstallPumaCall.Receives.Configuration.Puma.Workers).To(Equal("0"))
+				Expect(pumainstaller.InstallPumaCall.Receives.Configuration.Puma.Preload).To(BeFalse())
+
+				jarsLayer := result.Layers[len(result.Layers)-1]
+				Expect(jarsLayer.Name).To(Equal("jars"))
+				Expect(jarsLayer.Cache).To(BeTrue())
+				Expect(jarsLayer.Launch).To(BeTrue())
+				Expect(jarsLayer.LaunchEnv).To(HaveKeyWithValue("JARS_HOME.default", jarsLayer.Path))
+				Expect(os.Getenv("JARS_HOME")).To(Equal(jarsLayer.Path))
+			})
+
+			it("keeps the bundled RubyGems on TruffleRuby and ruby-head", func() {
+				for _, version := range []bundler.RubyVersion{
+					{Engine: "truffleruby", Major: 23, Minor: 1, Patch: 2},
+					{Engine: "ruby", Prerelease: "head"},
+				} {
+					versionResolver.LookupCall.Returns.Version = version
+					commands = nil
+
+					buffer = bytes.NewBuffer(nil)
+					logger := scribe.NewLogger(buffer)
+					configuration, _ := bundler.ReadConfiguration(ctx.CNBPath)
+					configuration.InstallPuma = false
+
+					_, err := bundler.InstallBundler(ctx, configuration, logger, versionResolver, calculator, bashCmd, pumainstaller)
+					Expect(err).NotTo(HaveOccurred())
+
+					Expect(commands).NotTo(ContainElement(ContainSubstring("--system")))
+					Expect(buffer.String()).To(ContainSubstring("Keeping the RubyGems version bundled with " + version.String()))
+				}
+			})
+		})
+
+		it("fails before installing if the Ruby version doesn't match the Gemfile and the policy is fail", func() {
+			Expect(os.WriteFile(filepath.Join(workingDir, "Gemfile"), []byte("ruby '3.2.2'\n"), 0644)).To(Succeed())
+			ctx = packit.BuildContext{
+				WorkingDir: workingDir,
+				CNBPath:    cnbDir,
+				Layers:     packit.Layers{Path: layersDir},
+			}
+
+			buffer = bytes.NewBuffer(nil)
+			logger := scribe.NewLogger(buffer)
+			configuration, _ := bundler.ReadConfiguration(ctx.CNBPath)
+			configuration.RubyVersionCheck = "fail"
+
+			_, err := bundler.InstallBundler(ctx, configuration, logger, versionResolver, calculator, bashCmd, pumainstaller)
+			Expect(err).To(MatchError("the Gemfile requires Ruby '3.2.2' but ruby-3.3.0 is active, fix the ruby directive in Gemfile or the Ruby installed by RVM"))
+			Expect(bashCmd.RunBashCmdCall.CallCount).To(Equal(0))
+		})
+
+		context("when Gemfile.lock doesn't contain the platform of the build", func() {
+			var (
+				lock     string
+				commands []string
+			)
+
+			it.Before(func() {
+				lock = "GEM\n  remote: https://rubygems.org/\n  specs:\n    rack (2.2.4)\n\nPLATFORMS\n  arm64-darwin-22\n\nDEPENDENCIES\n  rack\n"
+				Expect(os.WriteFile(filepath.Join(workingDir, "Gemfile.lock"), []byte(lock), 0600)).To(Succeed())
+
+				commands = nil
+				bashCmd.RunBashCmdCall.Stub = func(command string, dir string) (string, error) {
+					commands = append(commands, command)
+					if strings.HasPrefix(command, "bundle install") {
+						contents, err := os.ReadFile(filepath.Join(dir, "Gemfile.lock"))
+						Expect(err).NotTo(HaveOccurred())
+						Expect(string(contents)).To(ContainSubstring("with-platform"))
+					}
+					if strings.HasPrefix(command, "bundle lock") {
+						path := strings.Trim(command[strings.LastIndex(command, " ")+1:], "'")
+						return "", os.WriteFile(path, []byte(lock+"with-platform\n"), 0600)
+					}
+					return "", nil
+				}
+
+				ctx = packit.BuildContext{
+					WorkingDir: workingDir,
+					CNBPath:    cnbDir,
+					Stack:      "some-stack",
+					Layers:     packit.Layers{Path: layersDir},
+				}
+			})
+
+			it("installs the bundle from a copy with the platform and keeps the application's Gemfile.lock", func() {
+				buffer = bytes.NewBuffer(nil)
+				logger := scribe.NewLogger(buffer)
+				configuration, _ := bundler.ReadConfiguration(ctx.CNBPath)
+				configuration.InstallPuma = false
+
+				_, err := bundler.InstallBundler(ctx, configuration, logger, versionResolver, calculator, bashCmd, pumainstaller)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(commands).To(ContainElement(HavePrefix("bundle lock --add-platform")))
+				Expect(commands).To(ContainElement("bundle install"))
+				Expect(os.ReadFile(filepath.Join(workingDir, "Gemfile.lock"))).To(Equal([]byte(lock)))
+				Expect(os.ReadFile(filepath.Join(layersDir, "rvm-bundler", "Gemfile.lock"))).To(ContainSubstring("with-platform"))
+			})
+
+			it("fails for a deployment bundle, which couldn't be loaded at launch from the application's Gemfile.lock", func() {
+				Expect(os.MkdirAll(filepath.Join(workingDir, ".bundle"), os.ModePerm)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(workingDir, ".bundle", "config"), []byte("---\nBUNDLE_DEPLOYMENT: \"true\"\n"), 0644)).To(Succeed())
+
+				buffer = bytes.NewBuffer(nil)
+				logger := scribe.NewLogger(buffer)
+				configuration, _ := bundler.ReadConfiguration(ctx.CNBPath)
+				configuration.InstallPuma = false
+
+				_, err := bundler.InstallBundler(ctx, configuration, logger, versionResolver, calculator, bashCmd, pumainstaller)
+				Expect(err).To(MatchError(ContainSubstring("BUNDLE_DEPLOYMENT is set, Bundler would refuse to load the bundle at launch")))
+				Expect(commands).To(BeEmpty())
+				Expect(os.ReadFile(filepath.Join(workingDir, "Gemfile.lock"))).To(Equal([]byte(lock)))
+			})
+
+			it("restores the application's Gemfile.lock if the build fails", func() {
+				stub := bashCmd.RunBashCmdCall.Stub
+				bashCmd.RunBashCmdCall.Stub = func(command string, dir string) (string, error) {
+					if command == "bundle install" {
+						return "", errors.New("exit status 5")
+					}
+					return stub(command, dir)
+				}
+
+				buffer = bytes.NewBuffer(nil)
+				logger := scribe.NewLogger(buffer)
+				configuration, _ := bundler.ReadConfiguration(ctx.CNBPath)
+				configuration.InstallPuma = false
+
+				_, err := bundler.InstallBundler(ctx, configuration, logger, versionResolver, calculator, bashCmd, pumainstaller)
+				Expect(err).To(MatchError("exit status 5"))
+				Expect(os.ReadFile(filepath.Join(workingDir, "Gemfile.lock"))).To(Equal([]byte(lock)))
+			})
+
+			it("fails before installing with the policy fail", func() {
+				buffer = bytes.NewBuffer(nil)
+				logger := scribe.NewLogger(buffer)
+				configuration, _ := bundler.ReadConfiguration(ctx.CNBPath)
+				configuration.PlatformCheck = "fail"
+
+				_, err := bundler.InstallBundler(ctx, configuration, logger, versionResolver, calculator, bashCmd, pumainstaller)
+				Expect(err).To(MatchError(ContainSubstring("Gemfile.lock only supports the platforms arm64-darwin-22")))
+				Expect(commands).To(BeEmpty())
+			})
+		})
+
+		context("when the application has no Gemfile.lock", func() {
+			var commands []string
+
+			it.Before(func() {
+				Expect(os.Remove(filepath.Join(workingDir, "Gemfile.lock"))).To(Succeed())
+
+				commands = nil
+				bashCmd.RunBashCmdCall.Stub = func(command string, dir string) (string, error) {
+					commands = append(commands, command)
+					if command == "bundle lock" {
+						lock := "GEM\n  remote: https://rubygems.org/\n  specs:\n    rack (2.2.4)\n\nDEPENDENCIES\n  rack\n"
+						return "", os.WriteFile(filepath.Join(dir, "Gemfile.lock"), []byte(lock), 0644)
+					}
+					return "", nil
+				}
+
+				ctx = packit.BuildContext{
+					WorkingDir: workingDir,
+					CNBPath:    cnbDir,
+					Stack:      "some-stack",
+					Layers:     packit.Layers{Path: layersDir},
+				}
+			})
+
+			it("fails by default", func() {
+				buffer = bytes.NewBuffer(nil)
+				logger := scribe.NewLogger(buffer)
+				configuration, _ := bundler.ReadConfiguration(ctx.CNBPath)
+
+				_, err := bundler.InstallBundler(ctx, configuration, logger, versionResolver, calculator, bashCmd, pumainstaller)
+				Expect(err).To(MatchError(ContainSubstring("the application has no Gemfile.lock")))
+				Expect(commands).To(BeEmpty())
+			})
+
+			it("generates the Gemfile.lock, exports it into the layer and uses it for the cache key", func() {
+				buffer = bytes.NewBuffer(nil)
+				logger := scribe.NewLogger(buffer)
+				configuration, _ := bundler.ReadConfiguration(ctx.CNBPath)
+				configuration.InstallPuma = false
+				configuration.LockfilePolicy = "generate"
+
+				result, err := bundler.InstallBundler(ctx, configuration, logger, versionResolver, calculator, bashCmd, pumainstaller)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(commands).To(ContainElement("bundle lock"))
+				Expect(calculator.SumCall.Receives.Paths).To(ContainElement(filepath.Join(workingDir, "Gemfile.lock")))
+
+				layer := result.Layers[0]
+				Expect(layer.Metadata).To(HaveKeyWithValue("cache_sha", "other-checksum"))
+				Expect(layer.Metadata).To(HaveKeyWithValue("resolved_gems", []string{"rack 2.2.4"}))
+				Expect(filepath.Join(layer.Path, "lockfile", "Gemfile.lock")).To(BeAnExistingFile())
+				Expect(buffer.String()).To(ContainSubstring("rack 2.2.4"))
+			})
+
+			it("adds Puma to the Gemfile of a web application before generating the Gemfile.lock", func() {
+				Expect(os.WriteFile(filepath.Join(workingDir, "Gemfile"), []byte("source \"https://rubygems.org\"\n"), 0644)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(workingDir, "config.ru"), nil, 0644)).To(Succeed())
+				Expect(os.MkdirAll(filepath.Join(workingDir, "config"), os.ModePerm)).To(Succeed())
+
+				buffer = bytes.NewBuffer(nil)
+				logger := scribe.NewLogger(buffer)
+				configuration, _ := bundler.ReadConfiguration(ctx.CNBPath)
+				configuration.LockfilePolicy = "generate"
+
+				_, err := bundler.InstallBundler(ctx, configuration, logger, versionResolver, calculator, bashCmd, bundler.NewPumaInstaller())
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(commands).To(ContainElement("bundle lock"))
+				Expect(os.ReadFile(filepath.Join(workingDir, "Gemfile"))).To(ContainSubstring(fmt.Sprintf("gem \"puma\", \"%s\"", configuration.Puma.Version)))
+				Expect(filepath.Join(workingDir, "config", "puma.rb")).To(BeAnExistingFile())
+			})
+
+			it("reuses the layer and adds Puma again on the next build", func() {
+				gemfile := "source \"https://rubygems.org\"\n"
+				Expect(os.WriteFile(filepath.Join(workingDir, "Gemfile"), []byte(gemfile), 0644)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(workingDir, "config.ru"), nil, 0644)).To(Succeed())
+				Expect(os.MkdirAll(filepath.Join(workingDir, "config"), os.ModePerm)).To(Succeed())
+
+				bashCmd.RunBashCmdCall.Stub = func(command string, dir string) (string, error) {
+					commands = append(commands, command)
+					if command == "bundle lock" {
+						lock := "GEM\n  remote: https://rubygems.org/\n  specs:\n    puma (6.4.0)\n\nDEPENDENCIES\n  puma (= 6.4.0)\n"
+						return "", os.WriteFile(filepath.Join(dir, "Gemfile.lock"), []byte(lock), 0644)
+					}
+					return "", nil
+				}
+
+				configuration, _ := bundler.ReadConfiguration(ctx.CNBPath)
+				configuration.LockfilePolicy = "generate"
+
+				result, err := bundler.InstallBundler(ctx, configuration, scribe.NewLogger(bytes.NewBuffer(nil)), versionResolver, fs.NewChecksumCalculator(), bashCmd, bundler.NewPumaInstaller())
+				Expect(err).NotTo(HaveOccurred())
+				Expect(commands).To(ContainElement("bundle install"))
+
+				metadata := result.Layers[0].Metadata
+				Expect(os.WriteFile(filepath.Join(layersDir, "rvm-bundler.toml"), []byte(fmt.Sprintf(`[metadata]
+cache_sha = "%s"
+ruby_version = "%s"
+version = "%s"
+gems_manifest = []
+`, metadata["cache_sha"], metadata["ruby_version"], metadata["version"])), 0644)).To(Succeed())
+
+				// the next build starts from the application as checked out
+				Expect(os.WriteFile(filepath.Join(workingDir, "Gemfile"), []byte(gemfile), 0644)).To(Succeed())
+				Expect(os.Remove(filepath.Join(workingDir, "Gemfile.lock"))).To(Succeed())
+				commands = nil
+
+				buffer = bytes.NewBuffer(nil)
+				_, err = bundler.InstallBundler(ctx, configuration, scribe.NewLogger(buffer), versionResolver, fs.NewChecksumCalculator(), bashCmd, bundler.NewPumaInstaller())
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(buffer.String()).To(ContainSubstring("Reusing cached layer"))
+				Expect(commands).NotTo(ContainElement("bundle install"))
+				Expect(commands).NotTo(ContainElement("bundle lock"))
+				Expect(os.ReadFile(filepath.Join(workingDir, "Gemfile"))).To(ContainSubstring(fmt.Sprintf("gem \"puma\", \"%s\"", configuration.Puma.Version)))
+				Expect(os.ReadFile(filepath.Join(workingDir, "Gemfile.lock"))).To(ContainSubstring("puma (6.4.0)"))
+			})
+		})
+
+		context("when BUNDLE_GEMFILE is set in the build environment", func() {
+			it.Before(func() {
+				Expect(os.WriteFile(filepath.Join(workingDir, "Gemfile.next"), nil, 0644)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(workingDir, "Gemfile.next.lock"), nil, 0644)).To(Succeed())
+				Expect(os.Setenv("BUNDLE_GEMFILE", "Gemfile.next")).To(Succeed())
+
+				ctx = packit.BuildContext{
+					WorkingDir: workingDir,
+					CNBPath:    cnbDir,
+					Stack:      "some-stack",
+					Layers:     packit.Layers{Path: layersDir},
+				}
+			})
+
+			it.After(func() {
+				Expect(os.Unsetenv("BUNDLE_GEMFILE")).To(Succeed())
+			})
+
+			it("uses the Gemfile for the cache key and sets it at launch", func() {
+				buffer = bytes.NewBuffer(nil)
+				logger := scribe.NewLogger(buffer)
+				configuration, _ := bundler.ReadConfiguration(ctx.CNBPath)
+				configuration.InstallPuma = false
+
+				result, err := bundler.InstallBundler(ctx, configuration, logger, versionResolver, calculator, bashCmd, pumainstaller)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(calculator.SumCall.Receives.Paths[:2]).To(Equal([]string{
+					filepath.Join(workingDir, "Gemfile.next"),
+					filepath.Join(workingDir, "Gemfile.next.lock"),
+				}))
+				Expect(result.Layers[0].LaunchEnv).To(HaveKeyWithValue("BUNDLE_GEMFILE.default", filepath.Join(workingDir, "Gemfile.next")))
+			})
+		})
+
+		context("when the application is a monorepo with several Gemfiles", func() {
+			it.Before(func() {
+				for _, dir := range []string{"api", "jobs"} {
+					Expect(os.MkdirAll(filepath.Join(workingDir, "services", dir), os.ModePerm)).To(Succeed())
+				}
+				Expect(os.WriteFile(filepath.Join(workingDir, "services", "api", "Gemfile"), nil, 0644)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(workingDir, "services", "api", "Gemfile.lock"), nil, 0644)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(workingDir, "services", "api", "Procfile"), []byte("web: bundle exec puma\n"), 0644)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(workingDir, "services", "jobs", "gems.rb"), nil, 0644)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(workingDir, "services", "jobs", "gems.locked"), nil, 0644)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(workingDir, "services", "jobs", "Procfile"), []byte("worker: bundle exec sidekiq\n"), 0644)).To(Succeed())
+
+				ctx = packit.BuildContext{
+					WorkingDir: workingDir,
+					CNBPath:    cnbDir,
+					Stack:      "some-stack",
+					Layers:     packit.Layers{Path: layersDir},
+				}
+			})
+
+			it("installs every bundle into its own layer and scopes the processes to their bundle", func() {
+				buffer = bytes.NewBuffer(nil)
+				logger := scribe.NewLogger(buffer)
+				configuration, _ := bundler.ReadConfiguration(ctx.CNBPath)
+				configuration.InstallPuma = false
+				configuration.AppRoot = "services"
+				configuration.Gemfiles = []string{"api/Gemfile", "jobs/gems.rb"}
+
+				result, err := bundler.InstallBundles(ctx, configuration, logger, versionResolver, calculator, bashCmd, pumainstaller)
+				Expect(err).NotTo(HaveOccurred())
+
+				var names []string
+				for _, layer := range result.Layers {
+					names = append(names, layer.Name)
+				}
+				Expect(names).To(Equal([]string{"rvm-bundler", "gem-cache", "rvm-bundler-jobs"}))
+				Expect(calculator.SumCall.Receives.Paths[:2]).To(Equal([]string{
+					filepath.Join(workingDir, "services", "jobs", "gems.rb"),
+					filepath.Join(workingDir, "services", "jobs", "gems.locked"),
+				}))
+
+				Expect(result.Launch.Processes).To(Equal([]packit.Process{
+					{Type: "web", Command: "bundle exec puma", Default: true, WorkingDirectory: filepath.Join(workingDir, "services", "api")},
+					{Type: "jobs-worker", Command: "bundle exec sidekiq", WorkingDirectory: filepath.Join(workingDir, "services", "jobs")},
+				}))
+
+				Expect(result.Layers[0].LaunchEnv).To(BeEmpty())
+				Expect(result.Layers[0].BuildEnv).To(HaveKeyWithValue("BUNDLE_USER_CONFIG.default", filepath.Join(layersDir, "rvm-bundler", "config")))
+				Expect(result.Layers[0].ProcessLaunchEnv).To(HaveKey("web"))
+				Expect(result.Layers[0].ProcessLaunchEnv["web"]).To(HaveKeyWithValue("BUNDLE_GEMFILE.override", filepath.Join(workingDir, "services", "api", "Gemfile")))
+				Expect(result.Layers[0].ProcessLaunchEnv["web"]).To(HaveKeyWithValue("BUNDLE_USER_CONFIG.override", filepath.Join(layersDir, "rvm-bundler", "config")))
+				Expect(result.Layers[2].LaunchEnv).To(BeEmpty())
+				Expect(result.Layers[2].BuildEnv).To(BeEmpty())
+				Expect(result.Layers[2].ProcessLaunchEnv).To(HaveKey("jobs-worker"))
+				Expect(result.Layers[2].ProcessLaunchEnv["jobs-worker"]).To(HaveKeyWithValue("BUNDLE_GEMFILE.override", filepath.Join(workingDir, "services", "jobs", "gems.rb")))
+				Expect(result.Layers[2].ProcessLaunchEnv["jobs-worker"]).To(HaveKeyWithValue("BUNDLE_USER_CONFIG.override", filepath.Join(layersDir, "rvm-bundler-jobs", "config")))
+
+				_, ok := os.LookupEnv("BUNDLE_GEMFILE")
+				Expect(ok).To(BeFalse())
+			})
+
+			it("prepares the shared cache layers once for all bundles", func() {
+				bashCmd.RunBashCmdCall.Stub = func(command string, dir string) (string, error) {
+					if command == "bundle install" {
+						objectPath := filepath.Join(layersDir, "ccache", "cache", filepath.Base(dir)+".o")
+						Expect(os.MkdirAll(filepath.Dir(objectPath), os.ModePerm)).To(Succeed())
+						Expect(os.WriteFile(objectPath, nil, 0644)).To(Succeed())
+					}
+					return "", nil
+				}
+
+				buffer = bytes.NewBuffer(nil)
+				logger := scribe.NewLogger(buffer)
+				configuration, _ := bundler.ReadConfiguration(ctx.CNBPath)
+				configuration.InstallPuma = false
+				configuration.Ccache = true
+				configuration.AppRoot = "services"
+				configuration.Gemfiles = []string{"api/Gemfile", "jobs/gems.rb"}
+
+				result, err := bundler.InstallBundles(ctx, configuration, logger, versionResolver, calculator, bashCmd, pumainstaller)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(filepath.Join(layersDir, "ccache", "cache", "api.o")).To(BeAnExistingFile())
+				Expect(filepath.Join(layersDir, "ccache", "cache", "jobs.o")).To(BeAnExistingFile())
+				Expect(strings.Count(buffer.String(), "Using gem download cache")).To(Equal(1))
+
+				var names []string
+				for _, layer := range result.Layers {
+					names = append(names, layer.Name)
+				}
+				Expect(names).To(Equal([]string{"rvm-bundler", "gem-cache", "ccache", "rvm-bundler-jobs"}))
+			})
+
+			it("doesn't pass the environment of a bundle on to the next one", func() {
+				variables := []string{"BUNDLE_JOBS", "BUNDLE_RETRY", "MAKEFLAGS", "BUNDLE_USER_CONFIG", "BUNDLE_USER_CACHE"}
+				for _, name := range variables {
+					os.Unsetenv(name)
+				}
+
+				buffer = bytes.NewBuffer(nil)
+				logger := scribe.NewLogger(buffer)
+				configuration, _ := bundler.ReadConfiguration(ctx.CNBPath)
+				configuration.InstallPuma = false
+				configuration.AppRoot = "services"
+				configuration.Gemfiles = []string{"api/Gemfile", "jobs/gems.rb"}
+
+				_, err := bundler.InstallBundles(ctx, configuration, logger, versionResolver, calculator, bashCmd, pumainstaller)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(buffer.String()).NotTo(ContainSubstring("(set by the user)"))
+
+				for _, name := range variables {
+					_, ok := os.LookupEnv(name)
+					Expect(ok).To(BeFalse(), name)
+				}
+			})
+
+			it("writes the environment of every bundle for its own processes only", func() {
+				platformDir, err := ioutil.TempDir("", "platform")
+				Expect(err).NotTo(HaveOccurred())
+				defer os.RemoveAll(platformDir)
+
+				planPath := filepath.Join(cnbDir, "plan.toml")
+				Expect(os.WriteFile(planPath, nil, 0644)).To(Succeed())
+
+				pwd, err := os.Getwd()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(os.Chdir(workingDir)).To(Succeed())
+				defer os.Chdir(pwd)
+
+				configuration, _ := bundler.ReadConfiguration(cnbDir)
+				configuration.InstallPuma = false
+				configuration.AppRoot = "services"
+				configuration.Gemfiles = []string{"api/Gemfile", "jobs/gems.rb"}
+
+				exitHandler := &fakes.ExitHandler{}
+				packit.Build(func(context packit.BuildContext) (packit.BuildResult, error) {
+					return bundler.InstallBundles(context, configuration, scribe.NewLogger(bytes.NewBuffer(nil)), versionResolver, calculator, bashCmd, pumainstaller)
+				}, packit.WithArgs([]string{filepath.Join(cnbDir, "bin", "build"), layersDir, platformDir, planPath}), packit.WithExitHandler(exitHandler))
+				Expect(exitHandler.ErrorCall.Receives.Error).NotTo(HaveOccurred())
+
+				for _, layer := range []string{"rvm-bundler", "rvm-bundler-jobs"} {
+					files, err := filepath.Glob(filepath.Join(layersDir, layer, "env.launch", "*"))
+					Expect(err).NotTo(HaveOccurred())
+					for _, file := range files {
+						info, err := os.Stat(file)
+						Expect(err).NotTo(HaveOccurred())
+						Expect(info.IsDir()).To(BeTrue(), fmt.Sprintf("%s is exported to every process", file))
+					}
+				}
+
+				content, err := os.ReadFile(filepath.Join(layersDir, "rvm-bundler", "env.launch", "web", "BUNDLE_GEMFILE.override"))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(content)).To(Equal(filepath.Join(workingDir, "services", "api", "Gemfile")))
+
+				content, err = os.ReadFile(filepath.Join(layersDir, "rvm-bundler-jobs", "env.launch", "jobs-worker", "BUNDLE_GEMFILE.override"))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(content)).To(Equal(filepath.Join(workingDir, "services", "jobs", "gems.rb")))
+
+				content, err = os.ReadFile(filepath.Join(layersDir, "rvm-bundler-jobs", "env.launch", "jobs-worker", "BUNDLE_USER_CONFIG.override"))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(content)).To(Equal(filepath.Join(layersDir, "rvm-bundler-jobs", "config")))
+			})
+		})
+
+		context("when reproducible builds are enabled", func() {
+			it.Before(func() {
+				ctx = packit.BuildContext{
+					WorkingDir: workingDir,
+					CNBPath:    cnbDir,
+					Stack:      "some-stack",
+					Layers:     packit.Layers{Path: layersDir},
+					BuildpackInfo: packit.BuildpackInfo{
+						Name:    "Some Buildpack",
+						Version: "1.2.3",
+					},
+				}
+			})
+
+			it.After(func() {
+				os.Unsetenv("SOURCE_DATE_EPOCH")
+			})
+
+			it("pins the build time and the modification times to SOURCE_DATE_EPOCH", func() {
+				os.Setenv("SOURCE_DATE_EPOCH", "1666000000")
+				Expect(os.MkdirAll(filepath.Join(layersDir, "rvm-bundler", "ruby", "3.3.0"), os.ModePerm)).To(Succeed())
+
+				buffer = bytes.NewBuffer(nil)
+				logger := scribe.NewLogger(buffer)
+				configuration, _ := bundler.ReadConfiguration(ctx.CNBPath)
+				configuration.InstallPuma = false
+				configuration.Reproducible = true
+
+				result, err := bundler.InstallBundler(ctx, configuration, logger, versionResolver, calculator, bashCmd, pumainstaller)
+				Expect(err).NotTo(HaveOccurred())
+
+				layer := result.Layers[0]
+				Expect(layer.Metadata).To(HaveKeyWithValue("built_at", "2022-10-17T09:46:40Z"))
+
+				info, err := os.Stat(filepath.Join(layer.Path, "ruby", "3.3.0"))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(info.ModTime().Unix()).To(Equal(int64(1666000000)))
+			})
+
+			it("normalizes the bootsnap and jars launch layers", func() {
+				os.Setenv("SOURCE_DATE_EPOCH", "1666000000")
+				defer os.Unsetenv("JARS_HOME")
+				versionResolver.LookupCall.Returns.Version = bundler.RubyVersion{Engine: "jruby", Major: 9, Minor: 4, Patch: 3}
+				Expect(os.WriteFile(filepath.Join(workingDir, "Gemfile.lock"), []byte("GEM\n  specs:\n    bootsnap (1.16.0)\n\nPLATFORMS\n  java\n"), 0644)).To(Succeed())
+				Expect(os.MkdirAll(filepath.Join(layersDir, "jars", "org"), os.ModePerm)).To(Succeed())
+
+				Expect(os.MkdirAll(filepath.Join(workingDir, "app", "models"), os.ModePerm)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(workingDir, "app", "models", "user.rb"), nil, 0644)).To(Succeed())
+
+				precompiled := false
+				bashCmd.RunBashCmdCall.Stub = func(command string, dir string) (string, error) {
+					if strings.Contains(command, "bootsnap precompile") {
+						precompiled = true
+
+						// the sources are normalized before bootsnap keys its cache on them
+						for _, path := range []string{
+							filepath.Join(layersDir, "jars", "org"),
+							filepath.Join(workingDir, "app", "models", "user.rb"),
+						} {
+							info, err := os.Stat(path)
+							Expect(err).NotTo(HaveOccurred())
+							Expect(info.ModTime().Unix()).To(Equal(int64(1666000000)))
+						}
+
+						Expect(os.MkdirAll(filepath.Join(layersDir, "bootsnap", "bootsnap", "compile-cache-iseq"), os.ModePerm)).To(Succeed())
+					}
+					return "", nil
+				}
+
+				buffer = bytes.NewBuffer(nil)
+				logger := scribe.NewLogger(buffer)
+				configuration, _ := bundler.ReadConfiguration(ctx.CNBPath)
+				configuration.InstallPuma = false
+				configuration.Reproducible = true
+
+				_, err := bundler.InstallBundler(ctx, configuration, logger, versionResolver, calculator, bashCmd, pumainstaller)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(precompiled).To(BeTrue())
+
+				for _, path := range []string{
+					filepath.Join(layersDir, "jars", "org"),
+					filepath.Join(layersDir, "bootsnap", "bootsnap", "compile-cache-iseq"),
+				} {
+					info, err := os.Stat(path)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(info.ModTime().Unix()).To(Equal(int64(1666000000)))
+				}
+			})
+
+			it("leaves out the build time without SOURCE_DATE_EPOCH", func() {
+				buffer = bytes.NewBuffer(nil)
+				logger := scribe.NewLogger(buffer)
+				configuration, _ := bundler.ReadConfiguration(ctx.CNBPath)
+				configuration.InstallPuma = false
+				configuration.Reproducible = true
+
+				result, err := bundler.InstallBundler(ctx, configuration, logger, versionResolver, calculator, bashCmd, pumainstaller)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(result.Layers[0].Metadata).NotTo(HaveKey("built_at"))
+			})
+
+			it("returns an error for an invalid SOURCE_DATE_EPOCH", func() {
+				os.Setenv("SOURCE_DATE_EPOCH", "yesterday")
+
+				buffer = bytes.NewBuffer(nil)
+				logger := scribe.NewLogger(buffer)
+				configuration, _ := bundler.ReadConfiguration(ctx.CNBPath)
+				configuration.Reproducible = true
+
+				_, err := bundler.InstallBundler(ctx, configuration, logger, versionResolver, calculator, bashCmd, pumainstaller)
+				Expect(err).To(MatchError(ContainSubstring("invalid value of SOURCE_DATE_EPOCH")))
+			})
+		})
+
 		it("returns a result with creating `./bundle/config` file on the bundlerLayer", func() {
 
 			err := os.MkdirAll(filepath.Join(workingDir, ".bundle"), 0700)
@@ -217,7 +1313,7 @@ func testBundler(t *testing.T, context spec.G, it spec.S) {
 
 	context("ShouldRun", func() {
 		it.Before(func() {
-			versionResolver.LookupCall.Returns.Version = "ruby-2.3.4"
+			versionResolver.LookupCall.Returns.Version = bundler.RubyVersion{Engine: "ruby", Major: 2, Minor: 3, Patch: 4}
 			calculator.SumCall.Returns.String = "other-checksum"
 			Expect(os.WriteFile(filepath.Join(workingDir, "Gemfile.lock"), nil, 0600)).To(Succeed())
 		})
@@ -226,14 +1322,14 @@ func testBundler(t *testing.T, context spec.G, it spec.S) {
 			ok, checksum, rubyVersion, err := bundler.ShouldRun(map[string]interface{}{
 				"cache_sha":    "some-checksum",
 				"ruby_version": "ruby-1.2.3",
-			}, workingDir,
+			}, workingDir, "minor",
 				versionResolver,
 				calculator,
 				bashCmd)
 			Expect(err).NotTo(HaveOccurred())
 			Expect(ok).To(BeTrue())
 			Expect(checksum).To(Equal("other-checksum"))
-			Expect(rubyVersion).To(Equal("ruby-2.3.4"))
+			Expect(rubyVersion.String()).To(Equal("ruby-2.3.4"))
 
 			Expect(versionResolver.LookupCall.CallCount).To(Equal(1))
 
@@ -243,9 +1339,26 @@ func testBundler(t *testing.T, context spec.G, it spec.S) {
 			}))
 		})
 
+		it("includes the fingerprint paths in the checksum", func() {
+			hookPath := filepath.Join(workingDir, "bin", "cnb-pre-bundle")
+
+			_, _, _, err := bundler.ShouldRun(map[string]interface{}{}, workingDir, "minor",
+				versionResolver,
+				calculator,
+				bashCmd,
+				hookPath)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(calculator.SumCall.Receives.Paths).To(Equal([]string{
+				filepath.Join(workingDir, "Gemfile"),
+				filepath.Join(workingDir, "Gemfile.lock"),
+				hookPath,
+			}))
+		})
+
 		context("when the checksum matches, but the ruby version does not", func() {
 			it.Before(func() {
-				versionResolver.LookupCall.Returns.Version = "ruby-2.3.4"
+				versionResolver.LookupCall.Returns.Version = bundler.RubyVersion{Engine: "ruby", Major: 2, Minor: 3, Patch: 4}
 				calculator.SumCall.Returns.String = "some-checksum"
 			})
 
@@ -253,41 +1366,41 @@ func testBundler(t *testing.T, context spec.G, it spec.S) {
 				ok, checksum, rubyVersion, err := bundler.ShouldRun(map[string]interface{}{
 					"cache_sha":    "some-checksum",
 					"ruby_version": "ruby-1.2.3",
-				}, workingDir,
+				}, workingDir, "minor",
 					versionResolver,
 					calculator,
 					bashCmd)
 				Expect(err).NotTo(HaveOccurred())
 				Expect(ok).To(BeTrue())
 				Expect(checksum).To(Equal("some-checksum"))
-				Expect(rubyVersion).To(Equal("ruby-2.3.4"))
+				Expect(rubyVersion.String()).To(Equal("ruby-2.3.4"))
 			})
 		})
 
 		context("when the checksum doesn't match, but the ruby version does", func() {
 			it.Before(func() {
-				versionResolver.LookupCall.Returns.Version = "jruby-1.2.3.4"
+				versionResolver.LookupCall.Returns.Version = bundler.RubyVersion{Engine: "jruby", Major: 1, Minor: 2, Patch: 3}
 				calculator.SumCall.Returns.String = "other-checksum"
 			})
 
 			it("indicates that the install process should run", func() {
 				ok, checksum, rubyVersion, err := bundler.ShouldRun(map[string]interface{}{
 					"cache_sha":    "some-checksum",
-					"ruby_version": "jruby-1.2.3.4",
-				}, workingDir,
+					"ruby_version": "jruby-1.2",
+				}, workingDir, "minor",
 					versionResolver,
 					calculator,
 					bashCmd)
 				Expect(err).NotTo(HaveOccurred())
 				Expect(ok).To(BeTrue())
 				Expect(checksum).To(Equal("other-checksum"))
-				Expect(rubyVersion).To(Equal("jruby-1.2.3.4"))
+				Expect(rubyVersion.String()).To(Equal("jruby-1.2.3"))
 			})
 		})
 
 		context("when the checksum and ruby version matches", func() {
 			it.Before(func() {
-				versionResolver.LookupCall.Returns.Version = "jruby-1.2.3"
+				versionResolver.LookupCall.Returns.Version = bundler.RubyVersion{Engine: "jruby", Major: 1, Minor: 2, Patch: 3}
 
 				calculator.SumCall.Returns.String = "some-checksum"
 			})
@@ -295,15 +1408,46 @@ func testBundler(t *testing.T, context spec.G, it spec.S) {
 			it("indicates that the install process should not run", func() {
 				ok, checksum, rubyVersion, err := bundler.ShouldRun(map[string]interface{}{
 					"cache_sha":    "some-checksum",
-					"ruby_version": "jruby-1.2.3",
-				}, workingDir,
+					"ruby_version": "jruby-1.2",
+				}, workingDir, "minor",
 					versionResolver,
 					calculator,
 					bashCmd)
 				Expect(err).NotTo(HaveOccurred())
 				Expect(ok).To(BeFalse())
 				Expect(checksum).To(Equal("some-checksum"))
-				Expect(rubyVersion).To(Equal("jruby-1.2.3"))
+				Expect(rubyVersion.String()).To(Equal("jruby-1.2.3"))
+			})
+		})
+
+		context("when the cache key is sensitive to the patch version", func() {
+			it.Before(func() {
+				versionResolver.LookupCall.Returns.Version = bundler.RubyVersion{Engine: "ruby", Major: 2, Minor: 3, Patch: 5}
+				calculator.SumCall.Returns.String = "some-checksum"
+			})
+
+			it("indicates that the install process should run for a new patch version", func() {
+				ok, _, _, err := bundler.ShouldRun(map[string]interface{}{
+					"cache_sha":    "some-checksum",
+					"ruby_version": "ruby-2.3.4",
+				}, workingDir, "patch",
+					versionResolver,
+					calculator,
+					bashCmd)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(ok).To(BeTrue())
+			})
+
+			it("indicates that the install process should not run with a major sensitivity", func() {
+				ok, _, _, err := bundler.ShouldRun(map[string]interface{}{
+					"cache_sha":    "some-checksum",
+					"ruby_version": "ruby-2",
+				}, workingDir, "major",
+					versionResolver,
+					calculator,
+					bashCmd)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(ok).To(BeFalse())
 			})
 		})
 
@@ -317,7 +1461,7 @@ func testBundler(t *testing.T, context spec.G, it spec.S) {
 					_, _, _, err := bundler.ShouldRun(map[string]interface{}{
 						"cache_sha":    "some-checksum",
 						"ruby_version": "1.2.3",
-					}, workingDir,
+					}, workingDir, "minor",
 						versionResolver,
 						calculator,
 						bashCmd)
@@ -325,6 +1469,16 @@ func testBundler(t *testing.T, context spec.G, it spec.S) {
 				})
 			})
 
+			context("when the cache key sensitivity is invalid", func() {
+				it("returns an error", func() {
+					_, _, _, err := bundler.ShouldRun(map[string]interface{}{}, workingDir, "build",
+						versionResolver,
+						calculator,
+						bashCmd)
+					Expect(err).To(MatchError(ContainSubstring("invalid ruby version cache key sensitivity 'build'")))
+				})
+			})
+
 			context("when the Gemfile.lock cannot be stat'd", func() {
 				it.Before(func() {
 					Expect(os.Chmod(workingDir, 0000)).To(Succeed())
@@ -338,7 +1492,7 @@ func testBundler(t *testing.T, context spec.G, it spec.S) {
 					_, _, _, err := bundler.ShouldRun(map[string]interface{}{
 						"cache_sha":    "some-checksum",
 						"ruby_version": "ruby-1.2.3",
-					}, workingDir,
+					}, workingDir, "minor",
 						versionResolver,
 						calculator,
 						bashCmd)
@@ -359,7 +1513,7 @@ func testBundler(t *testing.T, context spec.G, it spec.S) {
 					_, _, _, err := bundler.ShouldRun(map[string]interface{}{
 						"cache_sha":    "some-checksum",
 						"ruby_version": "ruby-1.2.3",
-					}, workingDir,
+					}, workingDir, "minor",
 						versionResolver,
 						calculator,
 						bashCmd)
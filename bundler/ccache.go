@@ -0,0 +1,136 @@
+package bundler
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/paketo-buildpacks/packit/v2"
+	"github.com/paketo-buildpacks/packit/v2/scribe"
+)
+
+// PrepareCcache returns the cache-only "ccache" layer if ccache is enabled
+// and available in the build environment. The layer is keyed by the Ruby ABI,
+// i.e. the engine with its major and minor version, and the stack, because
+// object files compiled against another Ruby ABI or stack can't be reused.
+// The returned bool reports whether ccache is used.
+func PrepareCcache(context packit.BuildContext, rubyVersion RubyVersion, configuration Configuration, bashcmd BashCmd, logger scribe.Logger) (packit.Layer, bool, error) {
+	if !configuration.Ccache {
+		return packit.Layer{}, false, nil
+	}
+
+	_, err := bashcmd.RunBashCmd("command -v ccache", context.WorkingDir)
+	if err != nil {
+		logger.Process("Compiling native extensions without ccache because it is not available")
+		return packit.Layer{}, false, nil
+	}
+
+	ccacheLayer, err := context.Layers.Get("ccache")
+	if err != nil {
+		return packit.Layer{}, false, err
+	}
+
+	abi, err := rubyVersion.CacheKey(SensitivityMinor)
+	if err != nil {
+		return packit.Layer{}, false, err
+	}
+
+	cacheKey := fmt.Sprintf("%s/%s", abi, context.Stack)
+	cachedKey, ok := ccacheLayer.Metadata["cache_key"].(string)
+	if !ok || cachedKey != cacheKey {
+		ccacheLayer, err = ccacheLayer.Reset()
+		if err != nil {
+			return packit.Layer{}, false, err
+		}
+	}
+
+	ccacheLayer.Metadata = map[string]interface{}{
+		"cache_key": cacheKey,
+	}
+	ccacheLayer.Cache = true
+
+	return ccacheLayer, true, nil
+}
+
+// EnableCcache points CC and CXX to wrappers running the compilers through
+// ccache with its cache in the given layer and zeroes the ccache statistics
+func EnableCcache(ccacheLayer packit.Layer, workingDir string, bashcmd BashCmd) error {
+	binPath := filepath.Join(ccacheLayer.Path, "bin")
+	err := os.MkdirAll(binPath, os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	wrappers := []struct {
+		Env      string
+		Name     string
+		Compiler string
+	}{
+		{Env: "CC", Name: "cc", Compiler: "cc"},
+		{Env: "CXX", Name: "c++", Compiler: "c++"},
+	}
+
+	for _, wrapper := range wrappers {
+		wrapperPath := filepath.Join(binPath, wrapper.Name)
+
+		compiler := wrapper.Compiler
+		if env := os.Getenv(wrapper.Env); env != "" && env != wrapperPath {
+			compiler = env
+		}
+
+		err = os.WriteFile(wrapperPath, []byte(fmt.Sprintf("#!/bin/sh\nexec ccache %s \"$@\"\n", compiler)), 0755)
+		if err != nil {
+			return err
+		}
+
+		os.Setenv(wrapper.Env, wrapperPath)
+	}
+
+	os.Setenv("CCACHE_DIR", filepath.Join(ccacheLayer.Path, "cache"))
+
+	_, err = bashcmd.RunBashCmd("ccache --zero-stats", workingDir)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ReportCcacheStats logs the ccache hits and misses since EnableCcache.
+// Releases older than ccache 3.7 don't support --print-stats, their
+// statistics are logged as printed by "ccache -s" instead. The statistics are
+// informational only, failing to read them doesn't fail the build.
+func ReportCcacheStats(workingDir string, bashcmd BashCmd, logger scribe.Logger) {
+	output, err := bashcmd.RunBashCmd("ccache --print-stats", workingDir)
+	if err != nil {
+		output, err = bashcmd.RunBashCmd("ccache -s", workingDir)
+		if err != nil {
+			logger.Process("Failed to read the ccache statistics: %s", err)
+			return
+		}
+
+		logger.Process("ccache statistics:")
+		for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+			logger.Subprocess(line)
+		}
+		return
+	}
+
+	stats := map[string]int{}
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+
+		value, err := strconv.Atoi(fields[1])
+		if err == nil {
+			stats[fields[0]] = value
+		}
+	}
+
+	hits := stats["direct_cache_hit"] + stats["preprocessed_cache_hit"]
+	logger.Process("ccache: %d hits, %d misses", hits, stats["cache_miss"])
+}
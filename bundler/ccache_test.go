@@ -0,0 +1,187 @@
+package bundler_test
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/avarteqgmbh/rvm-bundler-cnb/bundler"
+	"github.com/avarteqgmbh/rvm-bundler-cnb/bundler/fakes"
+	"github.com/paketo-buildpacks/packit/v2"
+	"github.com/paketo-buildpacks/packit/v2/scribe"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testCcache(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+
+		workingDir    string
+		layersDir     string
+		bashCmd       *fakes.BashCmd
+		buffer        *bytes.Buffer
+		logger        scribe.Logger
+		ctx           packit.BuildContext
+		configuration bundler.Configuration
+		rubyVersion   bundler.RubyVersion
+	)
+
+	it.Before(func() {
+		var err error
+		workingDir, err = ioutil.TempDir("", "working-dir")
+		Expect(err).NotTo(HaveOccurred())
+
+		layersDir, err = ioutil.TempDir("", "layers")
+		Expect(err).NotTo(HaveOccurred())
+
+		bashCmd = &fakes.BashCmd{}
+		buffer = bytes.NewBuffer(nil)
+		logger = scribe.NewLogger(buffer)
+		ctx = packit.BuildContext{
+			WorkingDir: workingDir,
+			Stack:      "some-stack",
+			Layers:     packit.Layers{Path: layersDir},
+		}
+		configuration = bundler.Configuration{Ccache: true}
+		rubyVersion = bundler.RubyVersion{Engine: "ruby", Major: 3, Minor: 3, Patch: 0}
+	})
+
+	it.After(func() {
+		Expect(os.RemoveAll(workingDir)).To(Succeed())
+		Expect(os.RemoveAll(layersDir)).To(Succeed())
+	})
+
+	context("PrepareCcache", func() {
+		it("returns a cache layer keyed by the Ruby ABI and the stack", func() {
+			layer, ok, err := bundler.PrepareCcache(ctx, rubyVersion, configuration, bashCmd, logger)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ok).To(BeTrue())
+			Expect(bashCmd.RunBashCmdCall.Receives.Command).To(Equal("command -v ccache"))
+			Expect(layer.Cache).To(BeTrue())
+			Expect(layer.Build).To(BeFalse())
+			Expect(layer.Launch).To(BeFalse())
+			Expect(layer.Metadata).To(Equal(map[string]interface{}{"cache_key": "ruby-3.3/some-stack"}))
+		})
+
+		it("keeps the cache if the key didn't change", func() {
+			Expect(os.MkdirAll(filepath.Join(layersDir, "ccache", "cache"), os.ModePerm)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(layersDir, "ccache.toml"), []byte("[metadata]\ncache_key = \"ruby-3.3/some-stack\"\n"), 0644)).To(Succeed())
+
+			_, ok, err := bundler.PrepareCcache(ctx, rubyVersion, configuration, bashCmd, logger)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ok).To(BeTrue())
+			Expect(filepath.Join(layersDir, "ccache", "cache")).To(BeADirectory())
+		})
+
+		it("resets the cache if the Ruby version changed", func() {
+			Expect(os.MkdirAll(filepath.Join(layersDir, "ccache", "cache"), os.ModePerm)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(layersDir, "ccache.toml"), []byte("[metadata]\ncache_key = \"ruby-3.2/some-stack\"\n"), 0644)).To(Succeed())
+
+			_, ok, err := bundler.PrepareCcache(ctx, rubyVersion, configuration, bashCmd, logger)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ok).To(BeTrue())
+			Expect(filepath.Join(layersDir, "ccache", "cache")).NotTo(BeADirectory())
+		})
+
+		it("does nothing if ccache is disabled", func() {
+			_, ok, err := bundler.PrepareCcache(ctx, rubyVersion, bundler.Configuration{}, bashCmd, logger)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ok).To(BeFalse())
+			Expect(bashCmd.RunBashCmdCall.CallCount).To(Equal(0))
+		})
+
+		it("does nothing if ccache isn't available", func() {
+			bashCmd.RunBashCmdCall.Returns.Error = errors.New("exit status 1")
+
+			_, ok, err := bundler.PrepareCcache(ctx, rubyVersion, configuration, bashCmd, logger)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ok).To(BeFalse())
+			Expect(buffer.String()).To(ContainSubstring("Compiling native extensions without ccache because it is not available"))
+		})
+	})
+
+	context("EnableCcache", func() {
+		var commands []string
+
+		it.Before(func() {
+			commands = []string{}
+			bashCmd.RunBashCmdCall.Stub = func(command, dir string) (string, error) {
+				commands = append(commands, command)
+				return "", nil
+			}
+
+			os.Unsetenv("CC")
+			os.Unsetenv("CXX")
+		})
+
+		it.After(func() {
+			os.Unsetenv("CC")
+			os.Unsetenv("CXX")
+			os.Unsetenv("CCACHE_DIR")
+		})
+
+		it("points CC and CXX to ccache wrappers and zeroes the statistics", func() {
+			layer := packit.Layer{Path: filepath.Join(layersDir, "ccache")}
+
+			err := bundler.EnableCcache(layer, workingDir, bashCmd)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(os.Getenv("CC")).To(Equal(filepath.Join(layer.Path, "bin", "cc")))
+			Expect(os.Getenv("CXX")).To(Equal(filepath.Join(layer.Path, "bin", "c++")))
+			Expect(os.Getenv("CCACHE_DIR")).To(Equal(filepath.Join(layer.Path, "cache")))
+
+			contents, err := ioutil.ReadFile(filepath.Join(layer.Path, "bin", "cc"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(contents)).To(Equal("#!/bin/sh\nexec ccache cc \"$@\"\n"))
+
+			Expect(commands).To(Equal([]string{"ccache --zero-stats"}))
+		})
+
+		it("wraps the compilers set in the environment", func() {
+			os.Setenv("CC", "clang")
+			layer := packit.Layer{Path: filepath.Join(layersDir, "ccache")}
+
+			err := bundler.EnableCcache(layer, workingDir, bashCmd)
+			Expect(err).NotTo(HaveOccurred())
+
+			contents, err := ioutil.ReadFile(filepath.Join(layer.Path, "bin", "cc"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(contents)).To(Equal("#!/bin/sh\nexec ccache clang \"$@\"\n"))
+		})
+	})
+
+	context("ReportCcacheStats", func() {
+		it("logs the hits and misses", func() {
+			bashCmd.RunBashCmdCall.Returns.String = "stats_updated_timestamp\t1666000000\n\ndirect_cache_hit\t7\n\npreprocessed_cache_hit\t2\n\ncache_miss\t4\n\n"
+
+			bundler.ReportCcacheStats(workingDir, bashCmd, logger)
+			Expect(bashCmd.RunBashCmdCall.Receives.Command).To(Equal("ccache --print-stats"))
+			Expect(buffer.String()).To(ContainSubstring("ccache: 9 hits, 4 misses"))
+		})
+
+		it("logs the statistics of ccache releases without --print-stats", func() {
+			bashCmd.RunBashCmdCall.Stub = func(command, dir string) (string, error) {
+				if command == "ccache --print-stats" {
+					return "ccache: invalid option -- 'print-stats'", errors.New("exit status 1")
+				}
+				return "cache hit (direct)                     7\ncache miss                             4\n", nil
+			}
+
+			bundler.ReportCcacheStats(workingDir, bashCmd, logger)
+			Expect(bashCmd.RunBashCmdCall.Receives.Command).To(Equal("ccache -s"))
+			Expect(buffer.String()).To(ContainSubstring("cache hit (direct)                     7"))
+		})
+
+		it("doesn't fail if the statistics can't be read", func() {
+			bashCmd.RunBashCmdCall.Returns.Error = errors.New("exit status 1")
+
+			bundler.ReportCcacheStats(workingDir, bashCmd, logger)
+			Expect(buffer.String()).To(ContainSubstring("Failed to read the ccache statistics: exit status 1"))
+		})
+	})
+}
@@ -1,8 +1,11 @@
 package bundler
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 
 	"github.com/BurntSushi/toml"
 )
@@ -16,12 +19,43 @@ type Puma struct {
 	Preload bool   `toml:"preload"`
 }
 
+// Server represents the configuration structure shared by the web servers
+// other than Puma
+type Server struct {
+	Port    string `toml:"port"`
+	Workers string `toml:"workers"`
+	Timeout string `toml:"timeout"`
+}
+
 // Configuration represents this buildpack's configuration read from a table
 // named "configuration"
 type Configuration struct {
-	DefaultBundlerVersion string `toml:"default_bundler_version"`
-	InstallPuma           bool   `toml:"install_puma"`
-	Puma                  Puma   `toml:"puma"`
+	DefaultBundlerVersion  string   `toml:"default_bundler_version"`
+	InstallPuma            bool     `toml:"install_puma"`
+	Puma                   Puma     `toml:"puma"`
+	WebServer              string   `toml:"web_server"`
+	Server                 Server   `toml:"server"`
+	DefaultProcess         string   `toml:"default_process"`
+	Standalone             bool     `toml:"standalone"`
+	Binstubs               bool     `toml:"binstubs"`
+	PostInstallTasks       []string `toml:"post_install_tasks"`
+	PostInstallCacheDirs   []string `toml:"post_install_cache_dirs"`
+	PreBundleHook          string   `toml:"pre_bundle_hook"`
+	PostBundleHook         string   `toml:"post_bundle_hook"`
+	Verify                 bool     `toml:"verify"`
+	SmokeCommand           string   `toml:"smoke_command"`
+	Ccache                 bool     `toml:"ccache"`
+	Prune                  bool     `toml:"prune"`
+	PrunePatterns          []string `toml:"prune_patterns"`
+	PruneKeep              []string `toml:"prune_keep"`
+	StripDebug             bool     `toml:"strip_debug"`
+	Reproducible           bool     `toml:"reproducible"`
+	RubyVersionSensitivity string   `toml:"ruby_version_sensitivity"`
+	RubyVersionCheck       string   `toml:"ruby_version_check"`
+	PlatformCheck          string   `toml:"platform_check"`
+	LockfilePolicy         string   `toml:"lockfile_policy"`
+	AppRoot                string   `toml:"app_root"`
+	Gemfiles               []string `toml:"gemfiles"`
 }
 
 // MetaData represents this buildpack's metadata
@@ -46,3 +80,220 @@ func ReadConfiguration(cnbPath string) (Configuration, error) {
 
 	return meta.Metadata.Configuration, nil
 }
+
+// LoadConfiguration returns the configuration for this buildpack with the
+// settings of the application's buildpack.yml and of the BP_BUNDLER_*
+// environment variables applied on top of it
+func LoadConfiguration(cnbPath string, workingDir string) (Configuration, error) {
+	configuration, err := ReadConfiguration(cnbPath)
+	if err != nil {
+		return Configuration{}, err
+	}
+
+	buildpackYML, err := BuildpackYMLParse(filepath.Join(workingDir, "buildpack.yml"))
+	if err != nil {
+		return Configuration{}, err
+	}
+
+	if buildpackYML.WebServer != "" {
+		configuration.WebServer = buildpackYML.WebServer
+	}
+
+	if buildpackYML.DefaultProcess != "" {
+		configuration.DefaultProcess = buildpackYML.DefaultProcess
+	}
+
+	if buildpackYML.Standalone != nil {
+		configuration.Standalone = *buildpackYML.Standalone
+	}
+
+	if buildpackYML.Binstubs != nil {
+		configuration.Binstubs = *buildpackYML.Binstubs
+	}
+
+	if buildpackYML.PostInstallTasks != nil {
+		configuration.PostInstallTasks = buildpackYML.PostInstallTasks
+	}
+
+	if buildpackYML.PostInstallCacheDirs != nil {
+		configuration.PostInstallCacheDirs = buildpackYML.PostInstallCacheDirs
+	}
+
+	if buildpackYML.PreBundleHook != "" {
+		configuration.PreBundleHook = buildpackYML.PreBundleHook
+	}
+
+	if buildpackYML.PostBundleHook != "" {
+		configuration.PostBundleHook = buildpackYML.PostBundleHook
+	}
+
+	if buildpackYML.Verify != nil {
+		configuration.Verify = *buildpackYML.Verify
+	}
+
+	if buildpackYML.SmokeCommand != "" {
+		configuration.SmokeCommand = buildpackYML.SmokeCommand
+	}
+
+	if buildpackYML.Ccache != nil {
+		configuration.Ccache = *buildpackYML.Ccache
+	}
+
+	if buildpackYML.Prune != nil {
+		configuration.Prune = *buildpackYML.Prune
+	}
+
+	if buildpackYML.PrunePatterns != nil {
+		configuration.PrunePatterns = buildpackYML.PrunePatterns
+	}
+
+	if buildpackYML.PruneKeep != nil {
+		configuration.PruneKeep = buildpackYML.PruneKeep
+	}
+
+	if buildpackYML.StripDebug != nil {
+		configuration.StripDebug = *buildpackYML.StripDebug
+	}
+
+	if buildpackYML.Reproducible != nil {
+		configuration.Reproducible = *buildpackYML.Reproducible
+	}
+
+	if buildpackYML.RubyVersionSensitivity != "" {
+		configuration.RubyVersionSensitivity = buildpackYML.RubyVersionSensitivity
+	}
+
+	if buildpackYML.RubyVersionCheck != "" {
+		configuration.RubyVersionCheck = buildpackYML.RubyVersionCheck
+	}
+
+	if buildpackYML.PlatformCheck != "" {
+		configuration.PlatformCheck = buildpackYML.PlatformCheck
+	}
+
+	if buildpackYML.LockfilePolicy != "" {
+		configuration.LockfilePolicy = buildpackYML.LockfilePolicy
+	}
+
+	if buildpackYML.AppRoot != "" {
+		configuration.AppRoot = buildpackYML.AppRoot
+	}
+
+	if buildpackYML.Gemfiles != nil {
+		configuration.Gemfiles = buildpackYML.Gemfiles
+	}
+
+	if webServer, ok := os.LookupEnv("BP_BUNDLER_WEB_SERVER"); ok {
+		configuration.WebServer = webServer
+	}
+
+	if defaultProcess, ok := os.LookupEnv("BP_BUNDLER_DEFAULT_PROCESS"); ok {
+		configuration.DefaultProcess = defaultProcess
+	}
+
+	err = lookupEnvBool("BP_BUNDLER_STANDALONE", &configuration.Standalone)
+	if err != nil {
+		return Configuration{}, err
+	}
+
+	err = lookupEnvBool("BP_BUNDLER_BINSTUBS", &configuration.Binstubs)
+	if err != nil {
+		return Configuration{}, err
+	}
+
+	if tasks, ok := os.LookupEnv("BP_BUNDLER_POST_INSTALL_TASKS"); ok {
+		configuration.PostInstallTasks = strings.Fields(tasks)
+	}
+
+	if dirs, ok := os.LookupEnv("BP_BUNDLER_POST_INSTALL_CACHE_DIRS"); ok {
+		configuration.PostInstallCacheDirs = strings.Fields(dirs)
+	}
+
+	if hook, ok := os.LookupEnv("BP_BUNDLER_PRE_BUNDLE_HOOK"); ok {
+		configuration.PreBundleHook = hook
+	}
+
+	if hook, ok := os.LookupEnv("BP_BUNDLER_POST_BUNDLE_HOOK"); ok {
+		configuration.PostBundleHook = hook
+	}
+
+	err = lookupEnvBool("BP_BUNDLER_VERIFY", &configuration.Verify)
+	if err != nil {
+		return Configuration{}, err
+	}
+
+	if smokeCommand, ok := os.LookupEnv("BP_BUNDLER_SMOKE_COMMAND"); ok {
+		configuration.SmokeCommand = smokeCommand
+	}
+
+	err = lookupEnvBool("BP_BUNDLER_CCACHE", &configuration.Ccache)
+	if err != nil {
+		return Configuration{}, err
+	}
+
+	err = lookupEnvBool("BP_BUNDLER_PRUNE", &configuration.Prune)
+	if err != nil {
+		return Configuration{}, err
+	}
+
+	if patterns, ok := os.LookupEnv("BP_BUNDLER_PRUNE_PATTERNS"); ok {
+		configuration.PrunePatterns = strings.Fields(patterns)
+	}
+
+	if keep, ok := os.LookupEnv("BP_BUNDLER_PRUNE_KEEP"); ok {
+		configuration.PruneKeep = strings.Fields(keep)
+	}
+
+	err = lookupEnvBool("BP_BUNDLER_STRIP_DEBUG", &configuration.StripDebug)
+	if err != nil {
+		return Configuration{}, err
+	}
+
+	err = lookupEnvBool("BP_BUNDLER_REPRODUCIBLE", &configuration.Reproducible)
+	if err != nil {
+		return Configuration{}, err
+	}
+
+	if sensitivity, ok := os.LookupEnv("BP_BUNDLER_RUBY_VERSION_SENSITIVITY"); ok {
+		configuration.RubyVersionSensitivity = sensitivity
+	}
+
+	if check, ok := os.LookupEnv("BP_BUNDLER_RUBY_VERSION_CHECK"); ok {
+		configuration.RubyVersionCheck = check
+	}
+
+	if check, ok := os.LookupEnv("BP_BUNDLER_PLATFORM_CHECK"); ok {
+		configuration.PlatformCheck = check
+	}
+
+	if policy, ok := os.LookupEnv("BP_BUNDLER_LOCKFILE_POLICY"); ok {
+		configuration.LockfilePolicy = policy
+	}
+
+	if appRoot, ok := os.LookupEnv("BP_BUNDLER_APP_ROOT"); ok {
+		configuration.AppRoot = appRoot
+	}
+
+	if gemfiles, ok := os.LookupEnv("BP_BUNDLER_GEMFILES"); ok {
+		configuration.Gemfiles = strings.Fields(gemfiles)
+	}
+
+	return configuration, nil
+}
+
+// lookupEnvBool sets value to the boolean value of the given environment
+// variable if it is set
+func lookupEnvBool(name string, value *bool) error {
+	env, ok := os.LookupEnv(name)
+	if !ok {
+		return nil
+	}
+
+	parsed, err := strconv.ParseBool(env)
+	if err != nil {
+		return fmt.Errorf("invalid value of %s: %w", name, err)
+	}
+
+	*value = parsed
+	return nil
+}
@@ -67,9 +67,139 @@ func testConfiguration(t *testing.T, context spec.G, it spec.S) {
 					Threads: "5",
 					Preload: true,
 				},
+				WebServer: "auto",
+				Server: bundler.Server{
+					Port:    "8080",
+					Workers: "5",
+					Timeout: "60",
+				},
+				DefaultProcess:       "web",
+				Standalone:           false,
+				Binstubs:             true,
+				PostInstallTasks:     []string{},
+				PostInstallCacheDirs: []string{"public/assets", "tmp/cache/assets"},
+				PreBundleHook:        "bin/cnb-pre-bundle",
+				PostBundleHook:       "bin/cnb-post-bundle",
+				Verify:               false,
+				SmokeCommand:         `ruby -e 'require "bundler/setup"; Bundler.require(:default)'`,
+				Ccache:               false,
+				Prune:                false,
+				PrunePatterns: []string{
+					"cache/*.gem", "doc",
+					"gems/*/ext", "gems/*/test", "gems/*/spec", "gems/*/doc",
+					"bundler/gems/*/ext", "bundler/gems/*/test", "bundler/gems/*/spec", "bundler/gems/*/doc",
+					"**/*.o",
+				},
+				PruneKeep:    []string{},
+				StripDebug:   false,
+				Reproducible: false,
+
+				RubyVersionSensitivity: "minor",
+				RubyVersionCheck:       "warn",
+				PlatformCheck:          "add",
+				LockfilePolicy:         "fail",
+				AppRoot:                "",
+				Gemfiles:               []string{},
 			}))
 		})
 
+		context("when the application overrides the configuration", func() {
+			var workingDir string
+
+			it.Before(func() {
+				var err error
+				workingDir, err = ioutil.TempDir("", "working-dir")
+				Expect(err).NotTo(HaveOccurred())
+
+				someBuildPackTomlFile, err := ioutil.ReadFile(buildPackTomlPath)
+				Expect(err).NotTo(HaveOccurred())
+
+				err = ioutil.WriteFile(filepath.Join(cnbDir, "buildpack.toml"), someBuildPackTomlFile, 0644)
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			it.After(func() {
+				Expect(os.RemoveAll(workingDir)).To(Succeed())
+				Expect(os.Unsetenv("BP_BUNDLER_WEB_SERVER")).To(Succeed())
+				Expect(os.Unsetenv("BP_BUNDLER_STANDALONE")).To(Succeed())
+				Expect(os.Unsetenv("BP_BUNDLER_POST_INSTALL_TASKS")).To(Succeed())
+				Expect(os.Unsetenv("BP_BUNDLER_GEMFILES")).To(Succeed())
+			})
+
+			it("applies the settings of buildpack.yml", func() {
+				err := ioutil.WriteFile(filepath.Join(workingDir, "buildpack.yml"), []byte("rvm_bundler:\n  web_server: unicorn\n"), 0644)
+				Expect(err).NotTo(HaveOccurred())
+
+				configuration, err := bundler.LoadConfiguration(cnbDir, workingDir)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(configuration.WebServer).To(Equal("unicorn"))
+			})
+
+			it("applies the BP_BUNDLER_* environment variables last", func() {
+				err := ioutil.WriteFile(filepath.Join(workingDir, "buildpack.yml"), []byte("rvm_bundler:\n  web_server: unicorn\n"), 0644)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(os.Setenv("BP_BUNDLER_WEB_SERVER", "falcon")).To(Succeed())
+
+				configuration, err := bundler.LoadConfiguration(cnbDir, workingDir)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(configuration.WebServer).To(Equal("falcon"))
+			})
+
+			it("enables the standalone mode", func() {
+				err := ioutil.WriteFile(filepath.Join(workingDir, "buildpack.yml"), []byte("rvm_bundler:\n  standalone: true\n"), 0644)
+				Expect(err).NotTo(HaveOccurred())
+
+				configuration, err := bundler.LoadConfiguration(cnbDir, workingDir)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(configuration.Standalone).To(BeTrue())
+
+				Expect(os.Setenv("BP_BUNDLER_STANDALONE", "false")).To(Succeed())
+
+				configuration, err = bundler.LoadConfiguration(cnbDir, workingDir)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(configuration.Standalone).To(BeFalse())
+			})
+
+			it("reads the post-install tasks", func() {
+				err := ioutil.WriteFile(filepath.Join(workingDir, "buildpack.yml"), []byte("rvm_bundler:\n  post_install_tasks:\n  - assets:precompile\n  post_install_cache_dirs: []\n"), 0644)
+				Expect(err).NotTo(HaveOccurred())
+
+				configuration, err := bundler.LoadConfiguration(cnbDir, workingDir)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(configuration.PostInstallTasks).To(Equal([]string{"assets:precompile"}))
+				Expect(configuration.PostInstallCacheDirs).To(BeEmpty())
+
+				Expect(os.Setenv("BP_BUNDLER_POST_INSTALL_TASKS", "assets:precompile  bootsnap:precompile")).To(Succeed())
+
+				configuration, err = bundler.LoadConfiguration(cnbDir, workingDir)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(configuration.PostInstallTasks).To(Equal([]string{"assets:precompile", "bootsnap:precompile"}))
+			})
+
+			it("reads the Gemfiles of a monorepo", func() {
+				err := ioutil.WriteFile(filepath.Join(workingDir, "buildpack.yml"), []byte("rvm_bundler:\n  app_root: services\n  gemfiles:\n  - api/Gemfile\n"), 0644)
+				Expect(err).NotTo(HaveOccurred())
+
+				configuration, err := bundler.LoadConfiguration(cnbDir, workingDir)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(configuration.AppRoot).To(Equal("services"))
+				Expect(configuration.Gemfiles).To(Equal([]string{"api/Gemfile"}))
+
+				Expect(os.Setenv("BP_BUNDLER_GEMFILES", "api/Gemfile worker/gems.rb")).To(Succeed())
+
+				configuration, err = bundler.LoadConfiguration(cnbDir, workingDir)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(configuration.Gemfiles).To(Equal([]string{"api/Gemfile", "worker/gems.rb"}))
+			})
+
+			it("returns an error for an invalid boolean environment variable", func() {
+				Expect(os.Setenv("BP_BUNDLER_STANDALONE", "sometimes")).To(Succeed())
+
+				_, err := bundler.LoadConfiguration(cnbDir, workingDir)
+				Expect(err).To(MatchError(ContainSubstring("invalid value of BP_BUNDLER_STANDALONE")))
+			})
+		})
+
 		it.After(func() {
 			Expect(os.RemoveAll(cnbDir)).To(Succeed())
 		})
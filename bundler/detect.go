@@ -3,6 +3,8 @@ package bundler
 import (
 	"os"
 	"path/filepath"
+	"regexp"
+	"strings"
 
 	"github.com/avarteqgmbh/rvm-cnb/rvm"
 	"github.com/paketo-buildpacks/packit/v2"
@@ -14,24 +16,49 @@ type BuildPlanMetadata struct {
 	VersionSource     string `toml:"version_source"`
 }
 
+// RubyRequirementMetadata represents the metadata of the requirement of a
+// Ruby provider. RVM reads the version from "ruby_version" and MRI
+// buildpacks from "version".
+type RubyRequirementMetadata struct {
+	RubyVersion   string `toml:"ruby_version,omitempty"`
+	Version       string `toml:"version,omitempty"`
+	VersionSource string `toml:"version_source,omitempty"`
+	Build         bool   `toml:"build"`
+	Launch        bool   `toml:"launch"`
+}
+
+// patchLevelRegex matches the patch level of a Ruby version in a
+// Gemfile.lock, e.g. "p185" in "3.1.3p185"
+var patchLevelRegex = regexp.MustCompile(`p\d+$`)
+
 // VersionParser represents a parser for files like .ruby-version and Gemfiles
 type VersionParser interface {
 	ParseVersion(path string) (version string, err error)
 }
 
 // Detect whether this buildpack should install RVM
-func Detect(logger rvm.LogEmitter, bundlerVersionParser VersionParser, buildpackYMLParser VersionParser) packit.DetectFunc {
+func Detect(logger rvm.LogEmitter, bundlerVersionParser VersionParser, buildpackYMLParser VersionParser, rubyVersionParser VersionParser, gemfileParser VersionParser, gemfileLockParser VersionParser) packit.DetectFunc {
 	return func(context packit.DetectContext) (packit.DetectResult, error) {
-		_, err := os.Stat(filepath.Join(context.WorkingDir, "Gemfile"))
-		if os.IsNotExist(err) {
+		configuration, err := LoadConfiguration(context.CNBPath, context.WorkingDir)
+		if err != nil {
 			return packit.DetectResult{}, err
 		}
 
-		configuration, err := ReadConfiguration(context.CNBPath)
+		// The versions are read from the files of the primary bundle, e.g. the
+		// Gemfile in the app root
+		bundles, err := FindBundles(context.WorkingDir, configuration)
 		if err != nil {
 			return packit.DetectResult{}, err
 		}
 
+		gemfile := bundles[0].Gemfile()
+		_, err = os.Stat(gemfile.Path)
+		if os.IsNotExist(err) {
+			return packit.DetectResult{}, err
+		}
+		gemfilePath, lockPath := gemfile.Rel(context.WorkingDir)
+		rubyVersionPath := relPath(context.WorkingDir, filepath.Join(bundles[0].Dir, ".ruby-version"))
+
 		bundlerVersion := configuration.DefaultBundlerVersion
 
 		// NOTE: the order of the parsers is important, the last one to return a
@@ -39,7 +66,7 @@ func Detect(logger rvm.LogEmitter, bundlerVersionParser VersionParser, buildpack
 		versionEnvs := []rvm.VersionParserEnv{
 			{
 				Parser:  bundlerVersionParser,
-				Path:    "Gemfile.lock",
+				Path:    lockPath,
 				Context: context,
 				Logger:  logger,
 			},
@@ -53,24 +80,61 @@ func Detect(logger rvm.LogEmitter, bundlerVersionParser VersionParser, buildpack
 
 		for _, env := range versionEnvs {
 			err = rvm.ParseVersion(env, &bundlerVersion)
-			if err != nil {
+			if err != nil && !os.IsNotExist(err) {
 				logger.Detail("Parsing '%s' failed", env.Path)
 				return packit.DetectResult{}, err
 			}
 		}
 
 		logger.Detail("Detected Bundler version: %s", bundlerVersion)
+
+		rubyVersion, rubyVersionSource, err := detectRubyVersion(logger, context, gemfilePath, lockPath, rubyVersionPath, rubyVersionParser, gemfileParser, gemfileLockParser)
+		if err != nil {
+			return packit.DetectResult{}, err
+		}
+		rvmBundler := packit.BuildPlanRequirement{
+			Name: "rvm-bundler",
+			Metadata: BuildPlanMetadata{
+				RvmBundlerVersion: bundlerVersion,
+				VersionSource:     "rvm-bundler",
+			},
+		}
+
+		// Ruby is provided by RVM or, alternatively, by an MRI buildpack that
+		// puts Ruby on the PATH
 		return packit.DetectResult{
 			Plan: packit.BuildPlan{
 				Provides: []packit.BuildPlanProvision{
 					{Name: "rvm-bundler"},
 				},
 				Requires: []packit.BuildPlanRequirement{
+					rvmBundler,
 					{
-						Name: "rvm-bundler",
-						Metadata: BuildPlanMetadata{
-							RvmBundlerVersion: bundlerVersion,
-							VersionSource:     "rvm-bundler",
+						Name: "rvm",
+						Metadata: RubyRequirementMetadata{
+							RubyVersion:   rubyVersion,
+							VersionSource: rubyVersionSource,
+							Build:         true,
+							Launch:        true,
+						},
+					},
+				},
+				Or: []packit.BuildPlan{
+					{
+						Provides: []packit.BuildPlanProvision{
+							{Name: "rvm-bundler"},
+						},
+						Requires: []packit.BuildPlanRequirement{
+							rvmBundler,
+							{
+								Name: "mri",
+								Metadata: RubyRequirementMetadata{
+									Version:       mriVersion(rubyVersion),
+									VersionSource: rubyVersionSource,
+									Build:         true,
+									Launch:        true,
+								},
+							},
 						},
 					},
 				},
@@ -78,3 +142,59 @@ func Detect(logger rvm.LogEmitter, bundlerVersionParser VersionParser, buildpack
 		}, nil
 	}
 }
+
+// detectRubyVersion returns the Ruby version required by the application and
+// the file it was found in. Like the RVM CNB, a version in .ruby-version wins
+// over the ruby directive of the Gemfile, which wins over the RUBY VERSION of
+// the Gemfile.lock. The version is empty if none of them has one.
+func detectRubyVersion(logger rvm.LogEmitter, context packit.DetectContext, gemfilePath, lockPath, rubyVersionPath string, rubyVersionParser, gemfileParser, gemfileLockParser VersionParser) (string, string, error) {
+	var rubyVersion, rubyVersionSource string
+
+	// NOTE: the order of the parsers is important, the last one to return a
+	// ruby version string "wins"
+	versionEnvs := []rvm.VersionParserEnv{
+		{
+			Parser:  gemfileLockParser,
+			Path:    lockPath,
+			Context: context,
+			Logger:  logger,
+		},
+		{
+			Parser:  gemfileParser,
+			Path:    gemfilePath,
+			Context: context,
+			Logger:  logger,
+		},
+		{
+			Parser:  rubyVersionParser,
+			Path:    rubyVersionPath,
+			Context: context,
+			Logger:  logger,
+		},
+	}
+
+	for _, env := range versionEnvs {
+		var version string
+		err := rvm.ParseVersion(env, &version)
+		if err != nil && !os.IsNotExist(err) {
+			logger.Detail("Parsing '%s' failed", env.Path)
+			return "", "", err
+		}
+
+		if version != "" {
+			rubyVersion, rubyVersionSource = version, env.Path
+		}
+	}
+
+	if rubyVersion != "" {
+		logger.Detail("Detected Ruby version: %s", rubyVersion)
+	}
+
+	return rubyVersion, rubyVersionSource, nil
+}
+
+// mriVersion converts a Ruby version as understood by RVM, e.g. "ruby-3.1.2"
+// or "3.1.3p185", to the version number MRI buildpacks expect
+func mriVersion(rubyVersion string) string {
+	return patchLevelRegex.ReplaceAllString(strings.TrimPrefix(rubyVersion, "ruby-"), "")
+}
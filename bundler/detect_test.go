@@ -1,6 +1,7 @@
 package bundler_test
 
 import (
+	"errors"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -27,15 +28,21 @@ func testDetect(t *testing.T, context spec.G, it spec.S) {
 
 		bundlerVersionParser *fakes.VersionParser
 		buildpackYMLParser   *fakes.VersionParser
+		rubyVersionParser    *fakes.VersionParser
+		gemfileParser        *fakes.VersionParser
+		gemfileLockParser    *fakes.VersionParser
 		detect               packit.DetectFunc
 	)
 
 	it.Before(func() {
 		bundlerVersionParser = &fakes.VersionParser{}
 		buildpackYMLParser = &fakes.VersionParser{}
+		rubyVersionParser = &fakes.VersionParser{}
+		gemfileParser = &fakes.VersionParser{}
+		gemfileLockParser = &fakes.VersionParser{}
 
 		logger := rvm.NewLogEmitter(os.Stdout)
-		detect = bundler.Detect(logger, bundlerVersionParser, buildpackYMLParser)
+		detect = bundler.Detect(logger, bundlerVersionParser, buildpackYMLParser, rubyVersionParser, gemfileParser, gemfileLockParser)
 	})
 
 	it("returns a plan that does not provide RVM bundler because no Gemfile was found", func() {
@@ -89,6 +96,36 @@ func testDetect(t *testing.T, context spec.G, it spec.S) {
 							VersionSource:     "rvm-bundler",
 						},
 					},
+					{
+						Name: "rvm",
+						Metadata: bundler.RubyRequirementMetadata{
+							Build:  true,
+							Launch: true,
+						},
+					},
+				},
+				Or: []packit.BuildPlan{
+					{
+						Provides: []packit.BuildPlanProvision{
+							{Name: "rvm-bundler"},
+						},
+						Requires: []packit.BuildPlanRequirement{
+							{
+								Name: "rvm-bundler",
+								Metadata: bundler.BuildPlanMetadata{
+									RvmBundlerVersion: "2.1.4",
+									VersionSource:     "rvm-bundler",
+								},
+							},
+							{
+								Name: "mri",
+								Metadata: bundler.RubyRequirementMetadata{
+									Build:  true,
+									Launch: true,
+								},
+							},
+						},
+					},
 				},
 			}))
 		})
@@ -129,10 +166,209 @@ func testDetect(t *testing.T, context spec.G, it spec.S) {
 							VersionSource:     "rvm-bundler",
 						},
 					},
+					{
+						Name: "rvm",
+						Metadata: bundler.RubyRequirementMetadata{
+							Build:  true,
+							Launch: true,
+						},
+					},
+				},
+				Or: []packit.BuildPlan{
+					{
+						Provides: []packit.BuildPlanProvision{
+							{Name: "rvm-bundler"},
+						},
+						Requires: []packit.BuildPlanRequirement{
+							{
+								Name: "rvm-bundler",
+								Metadata: bundler.BuildPlanMetadata{
+									RvmBundlerVersion: "2.1.4",
+									VersionSource:     "rvm-bundler",
+								},
+							},
+							{
+								Name: "mri",
+								Metadata: bundler.RubyRequirementMetadata{
+									Build:  true,
+									Launch: true,
+								},
+							},
+						},
+					},
 				},
 			}))
 		})
 
+		context("when the app uses gems.rb", func() {
+			it.Before(func() {
+				Expect(os.Rename(filepath.Join(workingDir, "Gemfile"), filepath.Join(workingDir, "gems.rb"))).To(Succeed())
+				Expect(ioutil.WriteFile(filepath.Join(workingDir, "gems.locked"), nil, 0644)).To(Succeed())
+			})
+
+			it("reads the versions from gems.rb and gems.locked", func() {
+				gemfileParser.ParseVersionCall.Returns.Version = "2.6.5"
+
+				result, err := detect(packit.DetectContext{
+					CNBPath:    cnbDir,
+					WorkingDir: workingDir,
+				})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(bundlerVersionParser.ParseVersionCall.Receives.Path).To(Equal(filepath.Join(workingDir, "gems.locked")))
+				Expect(gemfileLockParser.ParseVersionCall.Receives.Path).To(Equal(filepath.Join(workingDir, "gems.locked")))
+				Expect(gemfileParser.ParseVersionCall.Receives.Path).To(Equal(filepath.Join(workingDir, "gems.rb")))
+				Expect(result.Plan.Requires[1].Metadata).To(Equal(bundler.RubyRequirementMetadata{
+					RubyVersion:   "2.6.5",
+					VersionSource: "gems.rb",
+					Build:         true,
+					Launch:        true,
+				}))
+			})
+		})
+
+		context("when BUNDLE_GEMFILE points to another Gemfile", func() {
+			it.Before(func() {
+				Expect(os.Rename(filepath.Join(workingDir, "Gemfile"), filepath.Join(workingDir, "Gemfile.next"))).To(Succeed())
+				Expect(os.Setenv("BUNDLE_GEMFILE", "Gemfile.next")).To(Succeed())
+			})
+
+			it.After(func() {
+				Expect(os.Unsetenv("BUNDLE_GEMFILE")).To(Succeed())
+			})
+
+			it("detects the application", func() {
+				_, err := detect(packit.DetectContext{
+					CNBPath:    cnbDir,
+					WorkingDir: workingDir,
+				})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(bundlerVersionParser.ParseVersionCall.Receives.Path).To(Equal(filepath.Join(workingDir, "Gemfile.next.lock")))
+			})
+		})
+
+		context("when the app root is a subdirectory", func() {
+			it.Before(func() {
+				Expect(os.MkdirAll(filepath.Join(workingDir, "services", "api"), os.ModePerm)).To(Succeed())
+				Expect(os.Rename(filepath.Join(workingDir, "Gemfile"), filepath.Join(workingDir, "services", "api", "Gemfile"))).To(Succeed())
+				Expect(os.Setenv("BP_BUNDLER_APP_ROOT", "services/api")).To(Succeed())
+			})
+
+			it.After(func() {
+				Expect(os.Unsetenv("BP_BUNDLER_APP_ROOT")).To(Succeed())
+			})
+
+			it("reads the versions from the app root", func() {
+				rubyVersionParser.ParseVersionCall.Returns.Version = "ruby-2.7.1"
+
+				result, err := detect(packit.DetectContext{
+					CNBPath:    cnbDir,
+					WorkingDir: workingDir,
+				})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(bundlerVersionParser.ParseVersionCall.Receives.Path).To(Equal(filepath.Join(workingDir, "services", "api", "Gemfile.lock")))
+				Expect(gemfileParser.ParseVersionCall.Receives.Path).To(Equal(filepath.Join(workingDir, "services", "api", "Gemfile")))
+				Expect(rubyVersionParser.ParseVersionCall.Receives.Path).To(Equal(filepath.Join(workingDir, "services", "api", ".ruby-version")))
+				Expect(result.Plan.Requires[1].Metadata).To(Equal(bundler.RubyRequirementMetadata{
+					RubyVersion:   "ruby-2.7.1",
+					VersionSource: "services/api/.ruby-version",
+					Build:         true,
+					Launch:        true,
+				}))
+			})
+
+			it("fails if the app root doesn't exist", func() {
+				Expect(os.Setenv("BP_BUNDLER_APP_ROOT", "services/web")).To(Succeed())
+
+				_, err := detect(packit.DetectContext{
+					CNBPath:    cnbDir,
+					WorkingDir: workingDir,
+				})
+				Expect(err).To(MatchError(ContainSubstring("invalid app root 'services/web'")))
+			})
+		})
+
+		context("when the app specifies a Ruby version", func() {
+			it.Before(func() {
+				gemfileLockParser.ParseVersionCall.Returns.Version = "2.6.3p62"
+			})
+
+			it("requires the Ruby version of Gemfile.lock", func() {
+				result, err := detect(packit.DetectContext{
+					CNBPath:    cnbDir,
+					WorkingDir: workingDir,
+				})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(result.Plan.Requires[1]).To(Equal(packit.BuildPlanRequirement{
+					Name: "rvm",
+					Metadata: bundler.RubyRequirementMetadata{
+						RubyVersion:   "2.6.3p62",
+						VersionSource: "Gemfile.lock",
+						Build:         true,
+						Launch:        true,
+					},
+				}))
+				Expect(result.Plan.Or[0].Requires[1]).To(Equal(packit.BuildPlanRequirement{
+					Name: "mri",
+					Metadata: bundler.RubyRequirementMetadata{
+						Version:       "2.6.3",
+						VersionSource: "Gemfile.lock",
+						Build:         true,
+						Launch:        true,
+					},
+				}))
+			})
+
+			it("prefers the ruby directive of the Gemfile over Gemfile.lock", func() {
+				gemfileParser.ParseVersionCall.Returns.Version = "2.6.5"
+
+				result, err := detect(packit.DetectContext{
+					CNBPath:    cnbDir,
+					WorkingDir: workingDir,
+				})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(result.Plan.Requires[1].Metadata).To(Equal(bundler.RubyRequirementMetadata{
+					RubyVersion:   "2.6.5",
+					VersionSource: "Gemfile",
+					Build:         true,
+					Launch:        true,
+				}))
+			})
+
+			it("prefers .ruby-version over the Gemfile", func() {
+				gemfileParser.ParseVersionCall.Returns.Version = "2.6.5"
+				rubyVersionParser.ParseVersionCall.Returns.Version = "ruby-2.7.1"
+
+				result, err := detect(packit.DetectContext{
+					CNBPath:    cnbDir,
+					WorkingDir: workingDir,
+				})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(result.Plan.Requires[1].Metadata).To(Equal(bundler.RubyRequirementMetadata{
+					RubyVersion:   "ruby-2.7.1",
+					VersionSource: ".ruby-version",
+					Build:         true,
+					Launch:        true,
+				}))
+				Expect(result.Plan.Or[0].Requires[1].Metadata).To(Equal(bundler.RubyRequirementMetadata{
+					Version:       "2.7.1",
+					VersionSource: ".ruby-version",
+					Build:         true,
+					Launch:        true,
+				}))
+				Expect(rubyVersionParser.ParseVersionCall.Receives.Path).To(Equal(filepath.Join(workingDir, ".ruby-version")))
+			})
+
+			it("fails if a version file can't be parsed", func() {
+				rubyVersionParser.ParseVersionCall.Returns.Err = errors.New("failed to parse .ruby-version")
+
+				_, err := detect(packit.DetectContext{
+					CNBPath:    cnbDir,
+					WorkingDir: workingDir,
+				})
+				Expect(err).To(MatchError("failed to parse .ruby-version"))
+			})
+		})
+
 		it.After(func() {
 			Expect(os.RemoveAll(workingDir)).To(Succeed())
 			Expect(os.RemoveAll(cnbDir)).To(Succeed())
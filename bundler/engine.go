@@ -0,0 +1,64 @@
+package bundler
+
+import (
+	"github.com/paketo-buildpacks/packit/v2/scribe"
+)
+
+// Ruby engines of a RubyVersion
+const (
+	EngineRuby        = "ruby"
+	EngineJRuby       = "jruby"
+	EngineTruffleRuby = "truffleruby"
+)
+
+// EnginePolicy describes how the installation of RubyGems, Bundler and Puma
+// is adapted to a Ruby engine and version
+type EnginePolicy struct {
+	// KeepRubyGems is set if the RubyGems version bundled with Ruby must not
+	// be updated
+	KeepRubyGems bool
+	// RubyGemsVersion is the version of rubygems-update to install, the
+	// latest one if empty
+	RubyGemsVersion string
+	// ThreadsOnly is set if the engine can't fork, so Puma has to run
+	// without workers
+	ThreadsOnly bool
+}
+
+// NewEnginePolicy returns the policy for the given Ruby version and Bundler
+// major version. MRI gets its RubyGems updated to the latest version that
+// supports the Ruby and Bundler versions. ruby-head, JRuby and TruffleRuby
+// keep the RubyGems they are bundled with, as they depend on their exact
+// RubyGems version. JRuby and TruffleRuby don't support fork.
+func NewEnginePolicy(version RubyVersion, bundlerMajorVersion int) EnginePolicy {
+	switch version.Engine {
+	case EngineJRuby, EngineTruffleRuby:
+		return EnginePolicy{KeepRubyGems: true, ThreadsOnly: true}
+	}
+
+	if version.IsHead() {
+		return EnginePolicy{KeepRubyGems: true}
+	}
+
+	if bundlerMajorVersion == 1 {
+		return EnginePolicy{RubyGemsVersion: "3.0.8"}
+	}
+
+	if ok, _ := version.Satisfies(">= 2.6, < 2.8"); ok {
+		// ruby gems 3.4.22 is the latest with Ruby 2.6 and 2.7 support
+		return EnginePolicy{RubyGemsVersion: "3.4.22"}
+	}
+
+	return EnginePolicy{}
+}
+
+// Configure adapts the configuration to the policy
+func (p EnginePolicy) Configure(configuration Configuration, logger scribe.Logger) Configuration {
+	if p.ThreadsOnly {
+		logger.Process("Configuring Puma with threads only because the Ruby engine doesn't support fork")
+		configuration.Puma.Workers = "0"
+		configuration.Puma.Preload = false
+	}
+
+	return configuration
+}
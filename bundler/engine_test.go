@@ -0,0 +1,62 @@
+package bundler_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/avarteqgmbh/rvm-bundler-cnb/bundler"
+	"github.com/paketo-buildpacks/packit/v2/scribe"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testEngine(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+	)
+
+	context("NewEnginePolicy", func() {
+		for _, example := range []struct {
+			Name    string
+			Version bundler.RubyVersion
+			Bundler int
+			Policy  bundler.EnginePolicy
+		}{
+			{Name: "updates RubyGems to the latest version for MRI", Version: bundler.RubyVersion{Engine: "ruby", Major: 3, Minor: 3}, Bundler: 2, Policy: bundler.EnginePolicy{}},
+			{Name: "pins RubyGems for Ruby 2.7", Version: bundler.RubyVersion{Engine: "ruby", Major: 2, Minor: 7, Patch: 8}, Bundler: 2, Policy: bundler.EnginePolicy{RubyGemsVersion: "3.4.22"}},
+			{Name: "pins RubyGems for Bundler 1", Version: bundler.RubyVersion{Engine: "ruby", Major: 3, Minor: 0}, Bundler: 1, Policy: bundler.EnginePolicy{RubyGemsVersion: "3.0.8"}},
+			{Name: "keeps RubyGems for ruby-head", Version: bundler.RubyVersion{Engine: "ruby", Prerelease: "head"}, Bundler: 2, Policy: bundler.EnginePolicy{KeepRubyGems: true}},
+			{Name: "keeps RubyGems and runs threads only for JRuby", Version: bundler.RubyVersion{Engine: "jruby", Major: 9, Minor: 4, Patch: 3}, Bundler: 2, Policy: bundler.EnginePolicy{KeepRubyGems: true, ThreadsOnly: true}},
+			{Name: "keeps RubyGems and runs threads only for jruby-head", Version: bundler.RubyVersion{Engine: "jruby", Prerelease: "head"}, Bundler: 2, Policy: bundler.EnginePolicy{KeepRubyGems: true, ThreadsOnly: true}},
+			{Name: "keeps RubyGems and runs threads only for TruffleRuby", Version: bundler.RubyVersion{Engine: "truffleruby", Major: 23, Minor: 1, Patch: 2}, Bundler: 2, Policy: bundler.EnginePolicy{KeepRubyGems: true, ThreadsOnly: true}},
+		} {
+			example := example
+
+			it(example.Name, func() {
+				policy := bundler.NewEnginePolicy(example.Version, example.Bundler)
+				Expect(policy).To(Equal(example.Policy))
+			})
+		}
+	})
+
+	context("Configure", func() {
+		it("runs Puma with threads only if the engine can't fork", func() {
+			policy := bundler.EnginePolicy{ThreadsOnly: true}
+			configuration := policy.Configure(bundler.Configuration{
+				Puma: bundler.Puma{Workers: "2", Threads: "5", Preload: true},
+			}, scribe.NewLogger(bytes.NewBuffer(nil)))
+
+			Expect(configuration.Puma).To(Equal(bundler.Puma{Workers: "0", Threads: "5", Preload: false}))
+		})
+
+		it("keeps the Puma workers if the engine can fork", func() {
+			policy := bundler.EnginePolicy{}
+			configuration := policy.Configure(bundler.Configuration{
+				Puma: bundler.Puma{Workers: "2", Threads: "5", Preload: true},
+			}, scribe.NewLogger(bytes.NewBuffer(nil)))
+
+			Expect(configuration.Puma).To(Equal(bundler.Puma{Workers: "2", Threads: "5", Preload: true}))
+		})
+	})
+}
@@ -15,14 +15,14 @@ type VersionResolver struct {
 			Bashcmd    bundler.BashCmd
 		}
 		Returns struct {
-			Version string
+			Version bundler.RubyVersion
 			Err     error
 		}
-		Stub func(string, bundler.BashCmd) (string, error)
+		Stub func(string, bundler.BashCmd) (bundler.RubyVersion, error)
 	}
 }
 
-func (f *VersionResolver) Lookup(param1 string, param2 bundler.BashCmd) (string, error) {
+func (f *VersionResolver) Lookup(param1 string, param2 bundler.BashCmd) (bundler.RubyVersion, error) {
 	f.LookupCall.mutex.Lock()
 	defer f.LookupCall.mutex.Unlock()
 	f.LookupCall.CallCount++
@@ -0,0 +1,33 @@
+package bundler
+
+import (
+	"os"
+
+	"github.com/paketo-buildpacks/packit/v2"
+	"github.com/paketo-buildpacks/packit/v2/scribe"
+)
+
+// PrepareGemCache configures Bundler to keep the downloaded .gem archives in
+// the cache-only "gem-cache" layer by enabling Bundler's global gem cache.
+// The archives don't depend on the Ruby ABI, so the layer outlives resets of
+// the bundler layer and a reinstall doesn't download every gem again.
+func PrepareGemCache(context packit.BuildContext, logger scribe.Logger) (packit.Layer, error) {
+	gemCacheLayer, err := context.Layers.Get("gem-cache")
+	if err != nil {
+		return packit.Layer{}, err
+	}
+
+	err = os.MkdirAll(gemCacheLayer.Path, os.ModePerm)
+	if err != nil {
+		return packit.Layer{}, err
+	}
+
+	logger.Process("Using gem download cache %s", gemCacheLayer.Path)
+
+	os.Setenv("BUNDLE_USER_CACHE", gemCacheLayer.Path)
+	os.Setenv("BUNDLE_GLOBAL_GEM_CACHE", "true")
+
+	gemCacheLayer.Cache = true
+
+	return gemCacheLayer, nil
+}
@@ -0,0 +1,71 @@
+package bundler
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// Gemfile represents the Gemfile of an application and its lockfile
+type Gemfile struct {
+	Path     string
+	LockPath string
+}
+
+// FindGemfile returns the Gemfile of the application like Bundler finds it.
+// BUNDLE_GEMFILE in the environment wins over BUNDLE_GEMFILE in the
+// application's .bundle/config, both relative to the application. Otherwise
+// the Gemfile is "Gemfile", or "gems.rb" if only that exists. The lockfile of
+// "gems.rb" is "gems.locked", the lockfile of any other Gemfile is the
+// Gemfile with the suffix ".lock", e.g. "Gemfile.next.lock". The Gemfile isn't
+// required to exist.
+func FindGemfile(workingDir string) Gemfile {
+	path, ok := os.LookupEnv("BUNDLE_GEMFILE")
+	if !ok || path == "" {
+		path, ok = appBundleConfig(workingDir, "BUNDLE_GEMFILE")
+	}
+
+	if !ok || path == "" {
+		path = "Gemfile"
+		if _, err := os.Stat(filepath.Join(workingDir, path)); os.IsNotExist(err) {
+			if _, err := os.Stat(filepath.Join(workingDir, "gems.rb")); err == nil {
+				path = "gems.rb"
+			}
+		}
+	}
+
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(workingDir, path)
+	}
+
+	return NewGemfile(path)
+}
+
+// NewGemfile returns the Gemfile at the given path with its lockfile
+func NewGemfile(path string) Gemfile {
+	lockPath := path + ".lock"
+	if filepath.Base(path) == "gems.rb" {
+		lockPath = filepath.Join(filepath.Dir(path), "gems.locked")
+	}
+
+	return Gemfile{
+		Path:     path,
+		LockPath: lockPath,
+	}
+}
+
+// Rel returns the paths of the Gemfile and its lockfile relative to the given
+// directory
+func (g Gemfile) Rel(workingDir string) (string, string) {
+	return relPath(workingDir, g.Path), relPath(workingDir, g.LockPath)
+}
+
+// relPath returns the path relative to the given directory, or the path itself
+// if it can't be made relative
+func relPath(workingDir, path string) string {
+	rel, err := filepath.Rel(workingDir, path)
+	if err != nil {
+		return path
+	}
+
+	return rel
+}
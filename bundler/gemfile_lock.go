@@ -0,0 +1,72 @@
+package bundler
+
+import (
+	"bufio"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// GemfileLock represents the sections of a Gemfile.lock that are of interest
+// to this buildpack
+type GemfileLock struct {
+	// Specs maps the name of every locked gem to its locked version, including
+	// a platform suffix like "-x86_64-linux" if one is present
+	Specs        map[string]string
+	Platforms    []string
+	Dependencies []string
+	RubyVersion  string
+	BundledWith  string
+}
+
+var gemfileLockSpecRegEx = regexp.MustCompile(`^    ([^ ]+) \(([^)]+)\)$`)
+
+// ParseGemfileLock parses the Gemfile.lock at the given path
+func ParseGemfileLock(path string) (GemfileLock, error) {
+	lock := GemfileLock{Specs: map[string]string{}}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return lock, err
+	}
+	defer file.Close()
+
+	section := ""
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \r")
+		if line == "" {
+			continue
+		}
+
+		if !strings.HasPrefix(line, " ") {
+			section = line
+			continue
+		}
+
+		switch section {
+		case "GEM", "PATH", "GIT", "PLUGIN SOURCE":
+			matches := gemfileLockSpecRegEx.FindStringSubmatch(line)
+			if matches != nil {
+				lock.Specs[matches[1]] = matches[2]
+			}
+		case "PLATFORMS":
+			lock.Platforms = append(lock.Platforms, strings.TrimSpace(line))
+		case "DEPENDENCIES":
+			name := strings.Fields(line)[0]
+			lock.Dependencies = append(lock.Dependencies, strings.TrimSuffix(name, "!"))
+		case "RUBY VERSION":
+			lock.RubyVersion = strings.TrimPrefix(strings.TrimSpace(line), "ruby ")
+		case "BUNDLED WITH":
+			lock.BundledWith = strings.TrimSpace(line)
+		}
+	}
+
+	return lock, scanner.Err()
+}
+
+// Has returns true if the given gem is part of the locked bundle
+func (l GemfileLock) Has(name string) bool {
+	_, ok := l.Specs[name]
+	return ok
+}
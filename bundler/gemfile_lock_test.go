@@ -0,0 +1,88 @@
+package bundler_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/avarteqgmbh/rvm-bundler-cnb/bundler"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testGemfileLock(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+
+		workingDir string
+	)
+
+	it.Before(func() {
+		var err error
+		workingDir, err = ioutil.TempDir("", "working-dir")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	it.After(func() {
+		Expect(os.RemoveAll(workingDir)).To(Succeed())
+	})
+
+	it("parses the sections of a Gemfile.lock", func() {
+		gemfileLock := `GIT
+  remote: https://github.com/some-org/some-gem.git
+  revision: 0123456789abcdef
+  specs:
+    some-gem (0.1.0)
+
+GEM
+  remote: https://rubygems.org/
+  specs:
+    nokogiri (1.13.6-x86_64-linux)
+      racc (~> 1.4)
+    puma (5.6.4)
+      nio4r (~> 2.0)
+    racc (1.6.0)
+
+PLATFORMS
+  ruby
+  x86_64-linux
+
+DEPENDENCIES
+  nokogiri
+  puma (~> 5.6)
+  some-gem!
+
+RUBY VERSION
+   ruby 3.1.2p20
+
+BUNDLED WITH
+   2.3.14
+`
+		path := filepath.Join(workingDir, "Gemfile.lock")
+		Expect(ioutil.WriteFile(path, []byte(gemfileLock), 0644)).To(Succeed())
+
+		lock, err := bundler.ParseGemfileLock(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(lock).To(Equal(bundler.GemfileLock{
+			Specs: map[string]string{
+				"some-gem": "0.1.0",
+				"nokogiri": "1.13.6-x86_64-linux",
+				"puma":     "5.6.4",
+				"racc":     "1.6.0",
+			},
+			Platforms:    []string{"ruby", "x86_64-linux"},
+			Dependencies: []string{"nokogiri", "puma", "some-gem"},
+			RubyVersion:  "3.1.2p20",
+			BundledWith:  "2.3.14",
+		}))
+		Expect(lock.Has("puma")).To(BeTrue())
+		Expect(lock.Has("nio4r")).To(BeFalse())
+	})
+
+	it("returns an error if the Gemfile.lock doesn't exist", func() {
+		_, err := bundler.ParseGemfileLock(filepath.Join(workingDir, "Gemfile.lock"))
+		Expect(os.IsNotExist(err)).To(BeTrue())
+	})
+}
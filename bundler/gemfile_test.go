@@ -0,0 +1,97 @@
+package bundler_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/avarteqgmbh/rvm-bundler-cnb/bundler"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testGemfile(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+
+		workingDir string
+	)
+
+	it.Before(func() {
+		var err error
+		workingDir, err = ioutil.TempDir("", "working-dir")
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(os.Unsetenv("BUNDLE_GEMFILE")).To(Succeed())
+	})
+
+	it.After(func() {
+		Expect(os.Unsetenv("BUNDLE_GEMFILE")).To(Succeed())
+		Expect(os.RemoveAll(workingDir)).To(Succeed())
+	})
+
+	context("FindGemfile", func() {
+		it("returns the Gemfile by default", func() {
+			Expect(bundler.FindGemfile(workingDir)).To(Equal(bundler.Gemfile{
+				Path:     filepath.Join(workingDir, "Gemfile"),
+				LockPath: filepath.Join(workingDir, "Gemfile.lock"),
+			}))
+		})
+
+		it("returns gems.rb and gems.locked if there is no Gemfile", func() {
+			Expect(ioutil.WriteFile(filepath.Join(workingDir, "gems.rb"), nil, 0644)).To(Succeed())
+
+			Expect(bundler.FindGemfile(workingDir)).To(Equal(bundler.Gemfile{
+				Path:     filepath.Join(workingDir, "gems.rb"),
+				LockPath: filepath.Join(workingDir, "gems.locked"),
+			}))
+		})
+
+		it("prefers the Gemfile over gems.rb", func() {
+			Expect(ioutil.WriteFile(filepath.Join(workingDir, "Gemfile"), nil, 0644)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(workingDir, "gems.rb"), nil, 0644)).To(Succeed())
+
+			Expect(bundler.FindGemfile(workingDir).Path).To(Equal(filepath.Join(workingDir, "Gemfile")))
+		})
+
+		it("returns the Gemfile set in .bundle/config", func() {
+			Expect(os.MkdirAll(filepath.Join(workingDir, ".bundle"), os.ModePerm)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(workingDir, ".bundle", "config"), []byte("---\nBUNDLE_GEMFILE: \"Gemfile.next\"\n"), 0644)).To(Succeed())
+
+			Expect(bundler.FindGemfile(workingDir)).To(Equal(bundler.Gemfile{
+				Path:     filepath.Join(workingDir, "Gemfile.next"),
+				LockPath: filepath.Join(workingDir, "Gemfile.next.lock"),
+			}))
+		})
+
+		it("prefers BUNDLE_GEMFILE in the environment", func() {
+			Expect(os.MkdirAll(filepath.Join(workingDir, ".bundle"), os.ModePerm)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(workingDir, ".bundle", "config"), []byte("---\nBUNDLE_GEMFILE: \"Gemfile.next\"\n"), 0644)).To(Succeed())
+			Expect(os.Setenv("BUNDLE_GEMFILE", "gemfiles/rails7.gemfile")).To(Succeed())
+
+			Expect(bundler.FindGemfile(workingDir)).To(Equal(bundler.Gemfile{
+				Path:     filepath.Join(workingDir, "gemfiles", "rails7.gemfile"),
+				LockPath: filepath.Join(workingDir, "gemfiles", "rails7.gemfile.lock"),
+			}))
+		})
+
+		it("keeps an absolute BUNDLE_GEMFILE", func() {
+			Expect(os.Setenv("BUNDLE_GEMFILE", "/other/app/gems.rb")).To(Succeed())
+
+			Expect(bundler.FindGemfile(workingDir)).To(Equal(bundler.Gemfile{
+				Path:     "/other/app/gems.rb",
+				LockPath: "/other/app/gems.locked",
+			}))
+		})
+	})
+
+	context("Rel", func() {
+		it("returns the paths relative to the application", func() {
+			gemfile, lock := bundler.FindGemfile(workingDir).Rel(workingDir)
+			Expect(gemfile).To(Equal("Gemfile"))
+			Expect(lock).To(Equal("Gemfile.lock"))
+		})
+	})
+}
@@ -0,0 +1,76 @@
+package bundler
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/paketo-buildpacks/packit/v2/chronos"
+	"github.com/paketo-buildpacks/packit/v2/scribe"
+)
+
+// HookPaths returns the absolute paths of the configured pre- and post-bundle
+// hooks that exist
+func HookPaths(workingDir string, configuration Configuration) []string {
+	var paths []string
+	for _, hook := range []string{configuration.PreBundleHook, configuration.PostBundleHook} {
+		if hook == "" {
+			continue
+		}
+
+		path := hookPath(workingDir, hook)
+		if fileExists(path) {
+			paths = append(paths, path)
+		}
+	}
+
+	return paths
+}
+
+// RunHook runs the executable hook at the given path, absolute or relative to
+// the application directory, in the same environment as the Bundler
+// commands. Nothing is run if the hook doesn't exist.
+func RunHook(name string, hook string, workingDir string, bashcmd BashCmd, logger scribe.Logger) error {
+	if hook == "" {
+		return nil
+	}
+
+	path := hookPath(workingDir, hook)
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if info.Mode()&0111 == 0 {
+		return fmt.Errorf("%s hook '%s' is not executable", name, hook)
+	}
+
+	clock := chronos.DefaultClock
+	timeStartHook := clock.Now()
+	logger.Process("Running %s hook '%s'", name, hook)
+
+	_, err = bashcmd.RunBashCmd(shellQuote(path), workingDir)
+	if err != nil {
+		return fmt.Errorf("%s hook '%s' failed: %w", name, hook, err)
+	}
+
+	timeDuration := clock.Now().Sub(timeStartHook)
+	logger.Action("Completed in %s", timeDuration.Round(time.Millisecond))
+	logger.Break()
+
+	return nil
+}
+
+// hookPath returns the absolute path of a hook, which is relative to the
+// application directory unless it is absolute
+func hookPath(workingDir string, hook string) string {
+	if filepath.IsAbs(hook) {
+		return hook
+	}
+
+	return filepath.Join(workingDir, hook)
+}
@@ -0,0 +1,104 @@
+package bundler_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/avarteqgmbh/rvm-bundler-cnb/bundler"
+	"github.com/avarteqgmbh/rvm-bundler-cnb/bundler/fakes"
+	"github.com/paketo-buildpacks/packit/v2/scribe"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testHooks(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+
+		workingDir string
+		bashCmd    *fakes.BashCmd
+		buffer     *bytes.Buffer
+		logger     scribe.Logger
+	)
+
+	it.Before(func() {
+		var err error
+		workingDir, err = ioutil.TempDir("", "working-dir")
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(os.MkdirAll(filepath.Join(workingDir, "bin"), os.ModePerm)).To(Succeed())
+
+		bashCmd = &fakes.BashCmd{}
+		buffer = bytes.NewBuffer(nil)
+		logger = scribe.NewLogger(buffer)
+	})
+
+	it.After(func() {
+		Expect(os.RemoveAll(workingDir)).To(Succeed())
+	})
+
+	context("RunHook", func() {
+		it("runs an executable hook in the application directory", func() {
+			Expect(ioutil.WriteFile(filepath.Join(workingDir, "bin", "cnb-pre-bundle"), nil, 0755)).To(Succeed())
+
+			err := bundler.RunHook("pre-bundle", "bin/cnb-pre-bundle", workingDir, bashCmd, logger)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(bashCmd.RunBashCmdCall.Receives.Command).To(Equal(fmt.Sprintf("'%s'", filepath.Join(workingDir, "bin", "cnb-pre-bundle"))))
+			Expect(bashCmd.RunBashCmdCall.Receives.WorkingDir).To(Equal(workingDir))
+			Expect(buffer.String()).To(ContainSubstring("Running pre-bundle hook 'bin/cnb-pre-bundle'"))
+		})
+
+		it("runs a hook at an absolute path", func() {
+			hooksDir, err := ioutil.TempDir("", "hooks dir")
+			Expect(err).NotTo(HaveOccurred())
+			defer os.RemoveAll(hooksDir)
+
+			hook := filepath.Join(hooksDir, "pre bundle")
+			Expect(ioutil.WriteFile(hook, nil, 0755)).To(Succeed())
+
+			err = bundler.RunHook("pre-bundle", hook, workingDir, bashCmd, logger)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(bashCmd.RunBashCmdCall.Receives.Command).To(Equal(fmt.Sprintf("'%s'", hook)))
+			Expect(bundler.HookPaths(workingDir, bundler.Configuration{PreBundleHook: hook})).To(Equal([]string{hook}))
+		})
+
+		it("does nothing if the hook doesn't exist", func() {
+			err := bundler.RunHook("pre-bundle", "bin/cnb-pre-bundle", workingDir, bashCmd, logger)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(bashCmd.RunBashCmdCall.CallCount).To(Equal(0))
+		})
+
+		it("returns an error if the hook isn't executable", func() {
+			Expect(ioutil.WriteFile(filepath.Join(workingDir, "bin", "cnb-post-bundle"), nil, 0644)).To(Succeed())
+
+			err := bundler.RunHook("post-bundle", "bin/cnb-post-bundle", workingDir, bashCmd, logger)
+			Expect(err).To(MatchError("post-bundle hook 'bin/cnb-post-bundle' is not executable"))
+		})
+
+		it("returns an error if the hook fails", func() {
+			Expect(ioutil.WriteFile(filepath.Join(workingDir, "bin", "cnb-post-bundle"), nil, 0755)).To(Succeed())
+			bashCmd.RunBashCmdCall.Returns.Error = errors.New("exit status 1")
+
+			err := bundler.RunHook("post-bundle", "bin/cnb-post-bundle", workingDir, bashCmd, logger)
+			Expect(err).To(MatchError("post-bundle hook 'bin/cnb-post-bundle' failed: exit status 1"))
+		})
+	})
+
+	context("HookPaths", func() {
+		it("returns the paths of the existing hooks", func() {
+			Expect(ioutil.WriteFile(filepath.Join(workingDir, "bin", "cnb-post-bundle"), nil, 0755)).To(Succeed())
+
+			paths := bundler.HookPaths(workingDir, bundler.Configuration{
+				PreBundleHook:  "bin/cnb-pre-bundle",
+				PostBundleHook: "bin/cnb-post-bundle",
+			})
+			Expect(paths).To(Equal([]string{filepath.Join(workingDir, "bin", "cnb-post-bundle")}))
+		})
+	})
+}
@@ -16,5 +16,26 @@ func TestUnitBundler(t *testing.T) {
 	suite("Bundler", testBundler)
 	suite("Puma", testPuma)
 	suite("RubyVersionResolver", testRubyVersionResolver)
+	suite("RubyVersion", testRubyVersion)
+	suite("RubyVersionCheck", testRubyVersionCheck)
+	suite("GemfileLock", testGemfileLock)
+	suite("WebServer", testWebServer)
+	suite("Procfile", testProcfile)
+	suite("ProcessInference", testProcessInference)
+	suite("Bootsnap", testBootsnap)
+	suite("PostInstallTasks", testPostInstallTasks)
+	suite("Hooks", testHooks)
+	suite("Verify", testVerify)
+	suite("LayerIntegrity", testLayerIntegrity)
+	suite("Ccache", testCcache)
+	suite("Parallelism", testParallelism)
+	suite("Prune", testPrune)
+	suite("Reproducible", testReproducible)
+	suite("Engine", testEngine)
+	suite("JRuby", testJRuby)
+	suite("Platform", testPlatform)
+	suite("Lockfile", testLockfile)
+	suite("Gemfile", testGemfile)
+	suite("Bundle", testBundle)
 	suite.Run(t)
 }
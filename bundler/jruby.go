@@ -0,0 +1,50 @@
+package bundler
+
+import (
+	"os"
+	"strings"
+
+	"github.com/paketo-buildpacks/packit/v2"
+	"github.com/paketo-buildpacks/packit/v2/scribe"
+)
+
+// CheckJavaPlatform warns if the Gemfile.lock of an application running on
+// JRuby lists platforms but no Java platform, since Bundler then has to
+// resolve the bundle again for JRuby
+func CheckJavaPlatform(lock GemfileLock, logger scribe.Logger) {
+	if len(lock.Platforms) == 0 {
+		return
+	}
+
+	for _, platform := range lock.Platforms {
+		if platform == "java" || strings.HasPrefix(platform, "universal-java") {
+			return
+		}
+	}
+
+	logger.Process("Warning: Gemfile.lock doesn't contain the 'java' platform needed for JRuby, run 'bundle lock --add-platform java' and commit Gemfile.lock")
+}
+
+// PrepareJarsCache returns the "jars" layer holding the Maven artifacts that
+// jar-dependencies downloads for the gems. JRuby loads the jars from
+// JARS_HOME at runtime, so the layer is a cache and launch layer.
+func PrepareJarsCache(context packit.BuildContext, logger scribe.Logger) (packit.Layer, error) {
+	jarsLayer, err := context.Layers.Get("jars")
+	if err != nil {
+		return packit.Layer{}, err
+	}
+
+	err = os.MkdirAll(jarsLayer.Path, os.ModePerm)
+	if err != nil {
+		return packit.Layer{}, err
+	}
+
+	logger.Process("Using jar-dependencies cache %s", jarsLayer.Path)
+
+	os.Setenv("JARS_HOME", jarsLayer.Path)
+	jarsLayer.LaunchEnv.Default("JARS_HOME", jarsLayer.Path)
+
+	jarsLayer.Cache, jarsLayer.Launch = true, true
+
+	return jarsLayer, nil
+}
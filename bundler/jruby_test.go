@@ -0,0 +1,43 @@
+package bundler_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/avarteqgmbh/rvm-bundler-cnb/bundler"
+	"github.com/paketo-buildpacks/packit/v2/scribe"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testJRuby(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+
+		buffer *bytes.Buffer
+		logger scribe.Logger
+	)
+
+	it.Before(func() {
+		buffer = bytes.NewBuffer(nil)
+		logger = scribe.NewLogger(buffer)
+	})
+
+	context("CheckJavaPlatform", func() {
+		it("accepts a lockfile with the java platform", func() {
+			bundler.CheckJavaPlatform(bundler.GemfileLock{Platforms: []string{"java", "x86_64-linux"}}, logger)
+			Expect(buffer.String()).To(BeEmpty())
+		})
+
+		it("accepts a lockfile with a universal-java platform", func() {
+			bundler.CheckJavaPlatform(bundler.GemfileLock{Platforms: []string{"universal-java-11"}}, logger)
+			Expect(buffer.String()).To(BeEmpty())
+		})
+
+		it("warns about a lockfile without a java platform", func() {
+			bundler.CheckJavaPlatform(bundler.GemfileLock{Platforms: []string{"x86_64-linux"}}, logger)
+			Expect(buffer.String()).To(ContainSubstring("run 'bundle lock --add-platform java'"))
+		})
+	})
+}
@@ -0,0 +1,129 @@
+package bundler
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/paketo-buildpacks/packit/v2"
+)
+
+// GemsManifest returns the sorted paths of the gem directories installed in
+// the given layer relative to the layer, e.g. "ruby/3.1.0/gems/rack-2.2.4"
+func GemsManifest(layerPath string) ([]string, error) {
+	matches, err := filepath.Glob(filepath.Join(layerPath, "*", "*", "gems", "*"))
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := []string{}
+	for _, match := range matches {
+		info, err := os.Stat(match)
+		if err != nil {
+			return nil, err
+		}
+
+		if !info.IsDir() {
+			continue
+		}
+
+		path, err := filepath.Rel(layerPath, match)
+		if err != nil {
+			return nil, err
+		}
+		manifest = append(manifest, filepath.ToSlash(path))
+	}
+
+	sort.Strings(manifest)
+	return manifest, nil
+}
+
+// CheckLayerIntegrity checks that a cached bundler layer can be reused. The
+// gem directories present in the layer are compared to the manifest stored in
+// the layer metadata at install time and "bundle check" has to succeed. The
+// reason why the layer can't be reused is returned, or an empty string if it
+// passes the check.
+func CheckLayerIntegrity(workingDir string, layer packit.Layer, bashcmd BashCmd) (string, error) {
+	cachedManifest, ok := metadataStrings(layer.Metadata["gems_manifest"])
+	if !ok {
+		return "the layer metadata contains no gems manifest", nil
+	}
+
+	manifest, err := GemsManifest(layer.Path)
+	if err != nil {
+		return "", err
+	}
+
+	var missing []string
+	for _, path := range cachedManifest {
+		if !contains(manifest, path) {
+			missing = append(missing, path)
+		}
+	}
+
+	if len(missing) > 0 {
+		return fmt.Sprintf("gem directories are missing: %s", strings.Join(missing, ", ")), nil
+	}
+
+	if len(manifest) != len(cachedManifest) {
+		return "the layer contains gem directories that are not in the gems manifest", nil
+	}
+
+	bundleCheckCmd := strings.Join([]string{
+		"bundle",
+		"check",
+	}, " ")
+	_, err = bashcmd.RunBashCmd(bundleCheckCmd, workingDir)
+	if err != nil {
+		return fmt.Sprintf("'%s' failed: %s", bundleCheckCmd, err), nil
+	}
+
+	return "", nil
+}
+
+// cleanBundlerLayer removes everything but the Bundler configuration and a
+// generated Gemfile.lock from the given layer
+func cleanBundlerLayer(layerPath string) error {
+	entries, err := os.ReadDir(layerPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	for _, entry := range entries {
+		if entry.Name() == "config" || entry.Name() == generatedLockfileDir {
+			continue
+		}
+
+		err = os.RemoveAll(filepath.Join(layerPath, entry.Name()))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// metadataStrings converts a list of strings read from the layer metadata
+func metadataStrings(value interface{}) ([]string, bool) {
+	switch list := value.(type) {
+	case []string:
+		return list, true
+	case []interface{}:
+		strs := []string{}
+		for _, item := range list {
+			str, ok := item.(string)
+			if !ok {
+				return nil, false
+			}
+			strs = append(strs, str)
+		}
+		return strs, true
+	}
+
+	return nil, false
+}
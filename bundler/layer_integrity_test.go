@@ -0,0 +1,104 @@
+package bundler_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/avarteqgmbh/rvm-bundler-cnb/bundler"
+	"github.com/avarteqgmbh/rvm-bundler-cnb/bundler/fakes"
+	"github.com/paketo-buildpacks/packit/v2"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testLayerIntegrity(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+
+		layerPath string
+		bashCmd   *fakes.BashCmd
+		layer     packit.Layer
+	)
+
+	it.Before(func() {
+		var err error
+		layerPath, err = ioutil.TempDir("", "layer")
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(os.MkdirAll(filepath.Join(layerPath, "ruby", "3.1.0", "gems", "rack-2.2.4"), os.ModePerm)).To(Succeed())
+		Expect(os.MkdirAll(filepath.Join(layerPath, "ruby", "3.1.0", "gems", "puma-5.6.4"), os.ModePerm)).To(Succeed())
+		Expect(os.MkdirAll(filepath.Join(layerPath, "ruby", "3.1.0", "cache"), os.ModePerm)).To(Succeed())
+
+		bashCmd = &fakes.BashCmd{}
+		layer = packit.Layer{
+			Path: layerPath,
+			Metadata: map[string]interface{}{
+				"gems_manifest": []interface{}{
+					"ruby/3.1.0/gems/puma-5.6.4",
+					"ruby/3.1.0/gems/rack-2.2.4",
+				},
+			},
+		}
+	})
+
+	it.After(func() {
+		Expect(os.RemoveAll(layerPath)).To(Succeed())
+	})
+
+	context("GemsManifest", func() {
+		it("returns the sorted gem directories of the layer", func() {
+			manifest, err := bundler.GemsManifest(layerPath)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(manifest).To(Equal([]string{
+				"ruby/3.1.0/gems/puma-5.6.4",
+				"ruby/3.1.0/gems/rack-2.2.4",
+			}))
+		})
+	})
+
+	context("CheckLayerIntegrity", func() {
+		it("passes if the gem directories match the manifest and bundle check succeeds", func() {
+			reason, err := bundler.CheckLayerIntegrity("/working-dir", layer, bashCmd)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(reason).To(BeEmpty())
+			Expect(bashCmd.RunBashCmdCall.Receives.Command).To(Equal("bundle check"))
+		})
+
+		it("fails if the layer metadata has no manifest", func() {
+			layer.Metadata = map[string]interface{}{}
+
+			reason, err := bundler.CheckLayerIntegrity("/working-dir", layer, bashCmd)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(reason).To(Equal("the layer metadata contains no gems manifest"))
+		})
+
+		it("fails if gem directories are missing", func() {
+			Expect(os.RemoveAll(filepath.Join(layerPath, "ruby", "3.1.0", "gems", "rack-2.2.4"))).To(Succeed())
+
+			reason, err := bundler.CheckLayerIntegrity("/working-dir", layer, bashCmd)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(reason).To(Equal("gem directories are missing: ruby/3.1.0/gems/rack-2.2.4"))
+			Expect(bashCmd.RunBashCmdCall.CallCount).To(Equal(0))
+		})
+
+		it("fails if the layer contains gem directories of another Ruby ABI", func() {
+			Expect(os.MkdirAll(filepath.Join(layerPath, "ruby", "3.2.0", "gems", "rack-2.2.4"), os.ModePerm)).To(Succeed())
+
+			reason, err := bundler.CheckLayerIntegrity("/working-dir", layer, bashCmd)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(reason).To(Equal("the layer contains gem directories that are not in the gems manifest"))
+		})
+
+		it("fails if bundle check fails", func() {
+			bashCmd.RunBashCmdCall.Returns.Error = errors.New("exit status 1")
+
+			reason, err := bundler.CheckLayerIntegrity("/working-dir", layer, bashCmd)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(reason).To(Equal("'bundle check' failed: exit status 1"))
+		})
+	})
+}
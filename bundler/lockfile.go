@@ -0,0 +1,126 @@
+package bundler
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/paketo-buildpacks/packit/v2/fs"
+	"github.com/paketo-buildpacks/packit/v2/scribe"
+)
+
+// Policies for applications without a Gemfile.lock
+const (
+	LockfilePolicyFail     = "fail"
+	LockfilePolicyGenerate = "generate"
+)
+
+// generatedLockfileDir is the directory of the bundler layer holding the
+// Gemfile.lock generated for an application without one
+const generatedLockfileDir = "lockfile"
+
+// RestoreLockfile handles applications without a Gemfile.lock. Depending on
+// the policy the build fails or the Gemfile.lock generated by a previous build
+// is copied from the layer into the application, so that the bundle resolves
+// to the same versions on every build. The returned bool reports whether the
+// application's Gemfile.lock is generated by the buildpack.
+func RestoreLockfile(workingDir, layerPath string, configuration Configuration, logger scribe.Logger) (bool, error) {
+	switch configuration.LockfilePolicy {
+	case LockfilePolicyFail, LockfilePolicyGenerate:
+	default:
+		return false, fmt.Errorf("invalid lockfile policy '%s', must be one of %s or %s", configuration.LockfilePolicy, LockfilePolicyFail, LockfilePolicyGenerate)
+	}
+
+	lockPath := FindGemfile(workingDir).LockPath
+	_, err := os.Stat(lockPath)
+	if err == nil {
+		return false, nil
+	}
+	if !os.IsNotExist(err) {
+		return false, err
+	}
+
+	if configuration.LockfilePolicy == LockfilePolicyFail {
+		return false, fmt.Errorf("the application has no %[1]s, run 'bundle lock' and commit %[1]s or set the lockfile policy to '%[2]s' to let the buildpack resolve the bundle", filepath.Base(lockPath), LockfilePolicyGenerate)
+	}
+
+	generatedLockPath := filepath.Join(layerPath, generatedLockfileDir, filepath.Base(lockPath))
+	_, err = os.Stat(generatedLockPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			logger.Process("The application has no %s, it will be generated", filepath.Base(lockPath))
+			logger.Break()
+			return true, nil
+		}
+		return false, err
+	}
+
+	logger.Process("The application has no %s, using the one generated by a previous build", filepath.Base(lockPath))
+	logger.Break()
+
+	return true, fs.Copy(generatedLockPath, lockPath)
+}
+
+// GenerateLockfile resolves the bundle of an application without a
+// Gemfile.lock with "bundle lock"
+func GenerateLockfile(workingDir string, bashcmd BashCmd, logger scribe.Logger) error {
+	lockPath := FindGemfile(workingDir).LockPath
+	_, err := os.Stat(lockPath)
+	if err == nil {
+		return nil
+	}
+	if !os.IsNotExist(err) {
+		return err
+	}
+
+	logger.Process("Generating %s", filepath.Base(lockPath))
+
+	bundleLockCmd := strings.Join([]string{
+		"bundle",
+		"lock",
+	}, " ")
+	output, err := bashcmd.RunBashCmd(bundleLockCmd, workingDir)
+	if err != nil {
+		return fmt.Errorf("failed to generate %s: %w\n%s", filepath.Base(lockPath), err, output)
+	}
+
+	return nil
+}
+
+// ExportLockfile copies the generated Gemfile.lock of the application into
+// the layer, logs the resolved versions and returns them as "name version"
+// for the layer metadata
+func ExportLockfile(workingDir, layerPath string, logger scribe.Logger) ([]string, error) {
+	lockPath := FindGemfile(workingDir).LockPath
+
+	err := os.MkdirAll(filepath.Join(layerPath, generatedLockfileDir), os.ModePerm)
+	if err != nil {
+		return nil, err
+	}
+
+	err = fs.Copy(lockPath, filepath.Join(layerPath, generatedLockfileDir, filepath.Base(lockPath)))
+	if err != nil {
+		return nil, err
+	}
+
+	lock, err := ParseGemfileLock(lockPath)
+	if err != nil {
+		return nil, err
+	}
+
+	resolved := []string{}
+	for name, version := range lock.Specs {
+		resolved = append(resolved, fmt.Sprintf("%s %s", name, version))
+	}
+	sort.Strings(resolved)
+
+	logger.Process("Resolved the bundle of the generated Gemfile.lock:")
+	for _, gem := range resolved {
+		logger.Subprocess(gem)
+	}
+	logger.Break()
+
+	return resolved, nil
+}
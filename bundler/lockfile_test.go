@@ -0,0 +1,130 @@
+package bundler_test
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/avarteqgmbh/rvm-bundler-cnb/bundler"
+	"github.com/avarteqgmbh/rvm-bundler-cnb/bundler/fakes"
+	"github.com/paketo-buildpacks/packit/v2/scribe"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testLockfile(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+
+		workingDir    string
+		layerPath     string
+		buffer        *bytes.Buffer
+		logger        scribe.Logger
+		bashCmd       *fakes.BashCmd
+		configuration bundler.Configuration
+	)
+
+	it.Before(func() {
+		var err error
+		workingDir, err = ioutil.TempDir("", "working-dir")
+		Expect(err).NotTo(HaveOccurred())
+
+		layerPath, err = ioutil.TempDir("", "layer")
+		Expect(err).NotTo(HaveOccurred())
+
+		buffer = bytes.NewBuffer(nil)
+		logger = scribe.NewLogger(buffer)
+		bashCmd = &fakes.BashCmd{}
+		configuration = bundler.Configuration{LockfilePolicy: "generate"}
+	})
+
+	it.After(func() {
+		Expect(os.RemoveAll(workingDir)).To(Succeed())
+		Expect(os.RemoveAll(layerPath)).To(Succeed())
+	})
+
+	context("RestoreLockfile", func() {
+		it("keeps the Gemfile.lock of the application", func() {
+			Expect(ioutil.WriteFile(filepath.Join(workingDir, "Gemfile.lock"), []byte("app"), 0644)).To(Succeed())
+
+			generated, err := bundler.RestoreLockfile(workingDir, layerPath, configuration, logger)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(generated).To(BeFalse())
+			Expect(ioutil.ReadFile(filepath.Join(workingDir, "Gemfile.lock"))).To(Equal([]byte("app")))
+		})
+
+		it("fails without a Gemfile.lock with the policy fail", func() {
+			configuration.LockfilePolicy = "fail"
+
+			_, err := bundler.RestoreLockfile(workingDir, layerPath, configuration, logger)
+			Expect(err).To(MatchError("the application has no Gemfile.lock, run 'bundle lock' and commit Gemfile.lock or set the lockfile policy to 'generate' to let the buildpack resolve the bundle"))
+		})
+
+		it("reports that the Gemfile.lock has to be generated", func() {
+			generated, err := bundler.RestoreLockfile(workingDir, layerPath, configuration, logger)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(generated).To(BeTrue())
+			Expect(filepath.Join(workingDir, "Gemfile.lock")).NotTo(BeAnExistingFile())
+			Expect(buffer.String()).To(ContainSubstring("The application has no Gemfile.lock, it will be generated"))
+		})
+
+		it("restores the Gemfile.lock generated by a previous build", func() {
+			Expect(os.MkdirAll(filepath.Join(layerPath, "lockfile"), os.ModePerm)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(layerPath, "lockfile", "Gemfile.lock"), []byte("generated"), 0644)).To(Succeed())
+
+			generated, err := bundler.RestoreLockfile(workingDir, layerPath, configuration, logger)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(generated).To(BeTrue())
+			Expect(ioutil.ReadFile(filepath.Join(workingDir, "Gemfile.lock"))).To(Equal([]byte("generated")))
+		})
+
+		it("fails on an invalid policy", func() {
+			configuration.LockfilePolicy = "maybe"
+
+			_, err := bundler.RestoreLockfile(workingDir, layerPath, configuration, logger)
+			Expect(err).To(MatchError("invalid lockfile policy 'maybe', must be one of fail or generate"))
+		})
+	})
+
+	context("GenerateLockfile", func() {
+		it("runs bundle lock", func() {
+			err := bundler.GenerateLockfile(workingDir, bashCmd, logger)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(bashCmd.RunBashCmdCall.Receives.Command).To(Equal("bundle lock"))
+			Expect(bashCmd.RunBashCmdCall.Receives.WorkingDir).To(Equal(workingDir))
+		})
+
+		it("keeps a restored Gemfile.lock", func() {
+			Expect(ioutil.WriteFile(filepath.Join(workingDir, "Gemfile.lock"), []byte("generated"), 0644)).To(Succeed())
+
+			err := bundler.GenerateLockfile(workingDir, bashCmd, logger)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(bashCmd.RunBashCmdCall.CallCount).To(Equal(0))
+		})
+
+		it("fails if bundle lock fails", func() {
+			bashCmd.RunBashCmdCall.Returns.String = "Could not find gem 'missing'"
+			bashCmd.RunBashCmdCall.Returns.Error = errors.New("exit status 7")
+
+			err := bundler.GenerateLockfile(workingDir, bashCmd, logger)
+			Expect(err).To(MatchError("failed to generate Gemfile.lock: exit status 7\nCould not find gem 'missing'"))
+		})
+	})
+
+	context("ExportLockfile", func() {
+		it("copies the Gemfile.lock into the layer and returns the resolved versions", func() {
+			lock := "GEM\n  remote: https://rubygems.org/\n  specs:\n    rack (2.2.4)\n    puma (6.4.0)\n\nPLATFORMS\n  x86_64-linux\n\nDEPENDENCIES\n  puma\n  rack\n"
+			Expect(ioutil.WriteFile(filepath.Join(workingDir, "Gemfile.lock"), []byte(lock), 0644)).To(Succeed())
+
+			resolved, err := bundler.ExportLockfile(workingDir, layerPath, logger)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resolved).To(Equal([]string{"puma 6.4.0", "rack 2.2.4"}))
+			Expect(ioutil.ReadFile(filepath.Join(layerPath, "lockfile", "Gemfile.lock"))).To(Equal([]byte(lock)))
+			Expect(buffer.String()).To(ContainSubstring("rack 2.2.4"))
+		})
+	})
+}
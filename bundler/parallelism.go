@@ -0,0 +1,138 @@
+package bundler
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/paketo-buildpacks/packit/v2/scribe"
+)
+
+// CgroupRoot is the path the cgroup file system is mounted at
+const CgroupRoot = "/sys/fs/cgroup"
+
+// DefaultBundleRetry is the number of retries of failed network requests of
+// Bundler if the user didn't configure it
+const DefaultBundleRetry = "3"
+
+// AvailableCPUs returns the number of CPUs available to the build. A CPU
+// quota of the cgroup (v2 "cpu.max" or v1 "cpu.cfs_quota_us") rounded up
+// limits runtime.NumCPU.
+func AvailableCPUs(cgroupRoot string) int {
+	cpus := runtime.NumCPU()
+
+	quota, period, ok := cgroupCPUQuota(cgroupRoot)
+	if ok {
+		quotaCPUs := int((quota + period - 1) / period)
+		if quotaCPUs < cpus {
+			cpus = quotaCPUs
+		}
+	}
+
+	if cpus < 1 {
+		cpus = 1
+	}
+
+	return cpus
+}
+
+// ConfigureParallelism sets BUNDLE_JOBS and MAKEFLAGS to the given number of
+// CPUs and BUNDLE_RETRY for the Bundler commands and the compilation of
+// native extensions. Values set in the environment or in the application's
+// Bundler configuration are kept.
+func ConfigureParallelism(workingDir string, cpus int, logger scribe.Logger) {
+	jobs := strconv.Itoa(cpus)
+
+	settings := []struct {
+		Name  string
+		Value string
+	}{
+		{Name: "BUNDLE_JOBS", Value: jobs},
+		{Name: "BUNDLE_RETRY", Value: DefaultBundleRetry},
+		{Name: "MAKEFLAGS", Value: fmt.Sprintf("-j%s", jobs)},
+	}
+
+	logger.Process("Using %d CPUs for the installation", cpus)
+	for _, setting := range settings {
+		if value, ok := os.LookupEnv(setting.Name); ok {
+			logger.Subprocess("%s=%s (set by the user)", setting.Name, value)
+			continue
+		}
+
+		if value, ok := appBundleConfig(workingDir, setting.Name); ok {
+			logger.Subprocess("%s=%s (set in .bundle/config)", setting.Name, value)
+			continue
+		}
+
+		os.Setenv(setting.Name, setting.Value)
+		logger.Subprocess("%s=%s", setting.Name, setting.Value)
+	}
+	logger.Break()
+}
+
+// cgroupCPUQuota returns the CPU quota and period of the cgroup if it has a
+// quota
+func cgroupCPUQuota(cgroupRoot string) (int64, int64, bool) {
+	contents, err := ioutil.ReadFile(filepath.Join(cgroupRoot, "cpu.max"))
+	if err == nil {
+		fields := strings.Fields(string(contents))
+		if len(fields) != 2 || fields[0] == "max" {
+			return 0, 0, false
+		}
+
+		return parseCPUQuota(fields[0], fields[1])
+	}
+
+	for _, dir := range []string{"cpu", "cpu,cpuacct"} {
+		quota, err := ioutil.ReadFile(filepath.Join(cgroupRoot, dir, "cpu.cfs_quota_us"))
+		if err != nil {
+			continue
+		}
+
+		period, err := ioutil.ReadFile(filepath.Join(cgroupRoot, dir, "cpu.cfs_period_us"))
+		if err != nil {
+			continue
+		}
+
+		return parseCPUQuota(strings.TrimSpace(string(quota)), strings.TrimSpace(string(period)))
+	}
+
+	return 0, 0, false
+}
+
+// parseCPUQuota parses a cgroup CPU quota and period, a negative quota means
+// no quota
+func parseCPUQuota(quota, period string) (int64, int64, bool) {
+	q, err := strconv.ParseInt(quota, 10, 64)
+	if err != nil || q <= 0 {
+		return 0, 0, false
+	}
+
+	p, err := strconv.ParseInt(period, 10, 64)
+	if err != nil || p <= 0 {
+		return 0, 0, false
+	}
+
+	return q, p, true
+}
+
+// appBundleConfig returns the value of the given key in the application's
+// .bundle/config
+func appBundleConfig(workingDir, key string) (string, bool) {
+	contents, err := ioutil.ReadFile(filepath.Join(workingDir, ".bundle", "config"))
+	if err != nil {
+		return "", false
+	}
+
+	for _, line := range strings.Split(string(contents), "\n") {
+		if strings.HasPrefix(line, key+":") {
+			return strings.Trim(strings.TrimSpace(strings.TrimPrefix(line, key+":")), `"'`), true
+		}
+	}
+
+	return "", false
+}
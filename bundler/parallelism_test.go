@@ -0,0 +1,121 @@
+package bundler_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/avarteqgmbh/rvm-bundler-cnb/bundler"
+	"github.com/paketo-buildpacks/packit/v2/scribe"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testParallelism(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+
+		cgroupRoot string
+	)
+
+	it.Before(func() {
+		var err error
+		cgroupRoot, err = ioutil.TempDir("", "cgroup")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	it.After(func() {
+		Expect(os.RemoveAll(cgroupRoot)).To(Succeed())
+	})
+
+	context("AvailableCPUs", func() {
+		it("falls back to the number of CPUs without a cgroup quota", func() {
+			Expect(bundler.AvailableCPUs(cgroupRoot)).To(Equal(runtime.NumCPU()))
+		})
+
+		it("ignores an unlimited cgroup v2 quota", func() {
+			Expect(ioutil.WriteFile(filepath.Join(cgroupRoot, "cpu.max"), []byte("max 100000\n"), 0644)).To(Succeed())
+
+			Expect(bundler.AvailableCPUs(cgroupRoot)).To(Equal(runtime.NumCPU()))
+		})
+
+		it("rounds up a cgroup v2 quota", func() {
+			Expect(ioutil.WriteFile(filepath.Join(cgroupRoot, "cpu.max"), []byte("50000 100000\n"), 0644)).To(Succeed())
+
+			Expect(bundler.AvailableCPUs(cgroupRoot)).To(Equal(1))
+		})
+
+		it("reads a cgroup v1 quota", func() {
+			Expect(os.MkdirAll(filepath.Join(cgroupRoot, "cpu,cpuacct"), os.ModePerm)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(cgroupRoot, "cpu,cpuacct", "cpu.cfs_quota_us"), []byte("100000\n"), 0644)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(cgroupRoot, "cpu,cpuacct", "cpu.cfs_period_us"), []byte("100000\n"), 0644)).To(Succeed())
+
+			Expect(bundler.AvailableCPUs(cgroupRoot)).To(Equal(1))
+		})
+
+		it("ignores an unlimited cgroup v1 quota", func() {
+			Expect(os.MkdirAll(filepath.Join(cgroupRoot, "cpu"), os.ModePerm)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(cgroupRoot, "cpu", "cpu.cfs_quota_us"), []byte("-1\n"), 0644)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(cgroupRoot, "cpu", "cpu.cfs_period_us"), []byte("100000\n"), 0644)).To(Succeed())
+
+			Expect(bundler.AvailableCPUs(cgroupRoot)).To(Equal(runtime.NumCPU()))
+		})
+	})
+
+	context("ConfigureParallelism", func() {
+		var (
+			workingDir string
+			buffer     *bytes.Buffer
+			logger     scribe.Logger
+		)
+
+		it.Before(func() {
+			var err error
+			workingDir, err = ioutil.TempDir("", "working-dir")
+			Expect(err).NotTo(HaveOccurred())
+
+			buffer = bytes.NewBuffer(nil)
+			logger = scribe.NewLogger(buffer)
+
+			os.Unsetenv("BUNDLE_JOBS")
+			os.Unsetenv("BUNDLE_RETRY")
+			os.Unsetenv("MAKEFLAGS")
+		})
+
+		it.After(func() {
+			os.Unsetenv("BUNDLE_JOBS")
+			os.Unsetenv("BUNDLE_RETRY")
+			os.Unsetenv("MAKEFLAGS")
+			Expect(os.RemoveAll(workingDir)).To(Succeed())
+		})
+
+		it("sets the number of jobs and retries", func() {
+			bundler.ConfigureParallelism(workingDir, 4, logger)
+
+			Expect(os.Getenv("BUNDLE_JOBS")).To(Equal("4"))
+			Expect(os.Getenv("BUNDLE_RETRY")).To(Equal("3"))
+			Expect(os.Getenv("MAKEFLAGS")).To(Equal("-j4"))
+			Expect(buffer.String()).To(ContainSubstring("Using 4 CPUs for the installation"))
+			Expect(buffer.String()).To(ContainSubstring("MAKEFLAGS=-j4"))
+		})
+
+		it("keeps the values set by the user", func() {
+			os.Setenv("MAKEFLAGS", "-j1")
+			Expect(os.MkdirAll(filepath.Join(workingDir, ".bundle"), os.ModePerm)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(workingDir, ".bundle", "config"), []byte("---\nBUNDLE_JOBS: \"2\"\n"), 0644)).To(Succeed())
+
+			bundler.ConfigureParallelism(workingDir, 4, logger)
+
+			Expect(os.Getenv("MAKEFLAGS")).To(Equal("-j1"))
+			_, ok := os.LookupEnv("BUNDLE_JOBS")
+			Expect(ok).To(BeFalse())
+			Expect(os.Getenv("BUNDLE_RETRY")).To(Equal("3"))
+			Expect(buffer.String()).To(ContainSubstring("MAKEFLAGS=-j1 (set by the user)"))
+			Expect(buffer.String()).To(ContainSubstring("BUNDLE_JOBS=2 (set in .bundle/config)"))
+		})
+	})
+}
@@ -0,0 +1,176 @@
+package bundler
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/paketo-buildpacks/packit/v2/fs"
+	"github.com/paketo-buildpacks/packit/v2/scribe"
+)
+
+// Policies of the Gemfile.lock platform check
+const (
+	PlatformCheckAdd  = "add"
+	PlatformCheckFail = "fail"
+	PlatformCheckOff  = "off"
+)
+
+// MuslLoaderGlob matches the dynamic loader of musl based stacks like Alpine
+var MuslLoaderGlob = "/lib/ld-musl-*.so.1"
+
+// BuildPlatform returns the Bundler platform of the build for the given Go
+// architecture, e.g. "x86_64-linux" or "aarch64-linux-musl" if the musl
+// loader matching the glob exists
+func BuildPlatform(goarch, muslLoaderGlob string) string {
+	arch := goarch
+	switch goarch {
+	case "amd64":
+		arch = "x86_64"
+	case "arm64":
+		arch = "aarch64"
+	}
+
+	platform := fmt.Sprintf("%s-linux", arch)
+	if loaders, _ := filepath.Glob(muslLoaderGlob); len(loaders) > 0 {
+		platform = fmt.Sprintf("%s-musl", platform)
+	}
+
+	return platform
+}
+
+// LockSupportsPlatform reports whether the PLATFORMS of a Gemfile.lock
+// include the given platform. The generic "ruby" platform supports every
+// platform, the gems are compiled from source.
+func LockSupportsPlatform(lock GemfileLock, platform string) bool {
+	for _, locked := range lock.Platforms {
+		if locked == "ruby" || locked == platform {
+			return true
+		}
+
+		if !strings.HasSuffix(platform, "-musl") && locked == fmt.Sprintf("%s-gnu", platform) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// CheckLockPlatform checks that the PLATFORMS of a Gemfile.lock include the
+// platform of the build. Depending on the policy a missing platform fails the
+// build or has to be added to a copy of the Gemfile.lock, which is reported
+// by the returned bool. A frozen bundle fails the build with either policy,
+// since Bundler refuses to load it at launch from the application's
+// Gemfile.lock, which lacks the platform of the installed gems.
+func CheckLockPlatform(workingDir string, lock GemfileLock, platform string, configuration Configuration, logger scribe.Logger) (bool, error) {
+	switch configuration.PlatformCheck {
+	case PlatformCheckOff:
+		return false, nil
+	case PlatformCheckAdd, PlatformCheckFail:
+	default:
+		return false, fmt.Errorf("invalid platform check policy '%s', must be one of %s, %s or %s", configuration.PlatformCheck, PlatformCheckAdd, PlatformCheckFail, PlatformCheckOff)
+	}
+
+	if len(lock.Platforms) == 0 || LockSupportsPlatform(lock, platform) {
+		return false, nil
+	}
+
+	if configuration.PlatformCheck == PlatformCheckFail {
+		return false, fmt.Errorf("Gemfile.lock only supports the platforms %s but the build runs on %s, precompiled gems for %s would be skipped, run 'bundle lock --add-platform %s' and commit Gemfile.lock", strings.Join(lock.Platforms, ", "), platform, platform, platform)
+	}
+
+	if key := frozenBy(workingDir); key != "" {
+		return false, fmt.Errorf("Gemfile.lock doesn't contain the platform %s of the build and %s is set, Bundler would refuse to load the bundle at launch since the application's Gemfile.lock isn't changed, run 'bundle lock --add-platform %s' and commit Gemfile.lock", platform, key, platform)
+	}
+
+	logger.Process("Warning: Gemfile.lock doesn't contain the platform %s of the build, adding it to a copy of Gemfile.lock, run 'bundle lock --add-platform %s' and commit Gemfile.lock", platform, platform)
+	logger.Break()
+
+	return true, nil
+}
+
+// frozenBy returns the setting freezing the bundle of the application, e.g.
+// BUNDLE_DEPLOYMENT, set in the environment or the application's
+// .bundle/config, or an empty string if the bundle isn't frozen
+func frozenBy(workingDir string) string {
+	for _, key := range []string{"BUNDLE_FROZEN", "BUNDLE_DEPLOYMENT"} {
+		value, ok := os.LookupEnv(key)
+		if !ok {
+			value, ok = appBundleConfig(workingDir, key)
+		}
+
+		if ok && value != "" && value != "false" {
+			return key
+		}
+	}
+
+	return ""
+}
+
+// UseLockPlatform adds the platform of the build to a copy of the Gemfile.lock
+// kept in the given layer and puts that copy in place of the application's
+// Gemfile.lock. The copy is created with "bundle lock --add-platform" if it
+// doesn't exist or has to be regenerated. The returned function restores the
+// application's Gemfile.lock, so that it isn't modified in the image.
+func UseLockPlatform(workingDir, layerPath, platform string, regenerate bool, bashcmd BashCmd, logger scribe.Logger) (func() error, error) {
+	lockPath := FindGemfile(workingDir).LockPath
+	layerLockPath := filepath.Join(layerPath, filepath.Base(lockPath))
+
+	if regenerate {
+		err := os.RemoveAll(layerLockPath)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	info, err := os.Stat(lockPath)
+	if err != nil {
+		return nil, err
+	}
+
+	original, err := ioutil.ReadFile(lockPath)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = os.Stat(layerLockPath)
+	if os.IsNotExist(err) {
+		logger.Process("Adding the platform %s to %s", platform, layerLockPath)
+
+		err = os.MkdirAll(layerPath, os.ModePerm)
+		if err != nil {
+			return nil, err
+		}
+
+		err = fs.Copy(lockPath, layerLockPath)
+		if err != nil {
+			return nil, err
+		}
+
+		bundleLockCmd := strings.Join([]string{
+			"bundle",
+			"lock",
+			"--add-platform",
+			platform,
+			"--lockfile",
+			shellQuote(layerLockPath),
+		}, " ")
+		output, err := bashcmd.RunBashCmd(bundleLockCmd, workingDir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to add the platform %s to Gemfile.lock: %w\n%s", platform, err, output)
+		}
+	} else if err != nil {
+		return nil, err
+	}
+
+	err = fs.Copy(layerLockPath, lockPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return func() error {
+		return ioutil.WriteFile(lockPath, original, info.Mode())
+	}, nil
+}
@@ -0,0 +1,192 @@
+package bundler_test
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/avarteqgmbh/rvm-bundler-cnb/bundler"
+	"github.com/avarteqgmbh/rvm-bundler-cnb/bundler/fakes"
+	"github.com/paketo-buildpacks/packit/v2/scribe"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testPlatform(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+
+		workingDir    string
+		layerPath     string
+		buffer        *bytes.Buffer
+		logger        scribe.Logger
+		bashCmd       *fakes.BashCmd
+		configuration bundler.Configuration
+	)
+
+	it.Before(func() {
+		var err error
+		workingDir, err = ioutil.TempDir("", "working-dir")
+		Expect(err).NotTo(HaveOccurred())
+
+		layerPath, err = ioutil.TempDir("", "layer")
+		Expect(err).NotTo(HaveOccurred())
+
+		buffer = bytes.NewBuffer(nil)
+		logger = scribe.NewLogger(buffer)
+		bashCmd = &fakes.BashCmd{}
+		configuration = bundler.Configuration{PlatformCheck: "add"}
+	})
+
+	it.After(func() {
+		Expect(os.RemoveAll(workingDir)).To(Succeed())
+		Expect(os.RemoveAll(layerPath)).To(Succeed())
+	})
+
+	context("BuildPlatform", func() {
+		it("returns the platform of a glibc build", func() {
+			Expect(bundler.BuildPlatform("amd64", filepath.Join(workingDir, "ld-musl-*.so.1"))).To(Equal("x86_64-linux"))
+			Expect(bundler.BuildPlatform("arm64", filepath.Join(workingDir, "ld-musl-*.so.1"))).To(Equal("aarch64-linux"))
+		})
+
+		it("returns the platform of a musl build", func() {
+			Expect(ioutil.WriteFile(filepath.Join(workingDir, "ld-musl-x86_64.so.1"), nil, 0755)).To(Succeed())
+
+			Expect(bundler.BuildPlatform("amd64", filepath.Join(workingDir, "ld-musl-*.so.1"))).To(Equal("x86_64-linux-musl"))
+		})
+	})
+
+	context("LockSupportsPlatform", func() {
+		it("accepts the platform, its gnu variant and the ruby platform", func() {
+			Expect(bundler.LockSupportsPlatform(bundler.GemfileLock{Platforms: []string{"x86_64-linux"}}, "x86_64-linux")).To(BeTrue())
+			Expect(bundler.LockSupportsPlatform(bundler.GemfileLock{Platforms: []string{"x86_64-linux-gnu"}}, "x86_64-linux")).To(BeTrue())
+			Expect(bundler.LockSupportsPlatform(bundler.GemfileLock{Platforms: []string{"arm64-darwin", "ruby"}}, "x86_64-linux")).To(BeTrue())
+		})
+
+		it("rejects other platforms and libcs", func() {
+			Expect(bundler.LockSupportsPlatform(bundler.GemfileLock{Platforms: []string{"arm64-darwin", "x86_64-darwin"}}, "x86_64-linux")).To(BeFalse())
+			Expect(bundler.LockSupportsPlatform(bundler.GemfileLock{Platforms: []string{"aarch64-linux"}}, "x86_64-linux")).To(BeFalse())
+			Expect(bundler.LockSupportsPlatform(bundler.GemfileLock{Platforms: []string{"x86_64-linux-gnu"}}, "x86_64-linux-musl")).To(BeFalse())
+		})
+	})
+
+	context("CheckLockPlatform", func() {
+		var lock bundler.GemfileLock
+
+		it.Before(func() {
+			lock = bundler.GemfileLock{Platforms: []string{"arm64-darwin"}}
+		})
+
+		it("reports a missing platform to be added", func() {
+			add, err := bundler.CheckLockPlatform(workingDir, lock, "x86_64-linux", configuration, logger)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(add).To(BeTrue())
+			Expect(buffer.String()).To(ContainSubstring("Gemfile.lock doesn't contain the platform x86_64-linux of the build"))
+		})
+
+		it("accepts a Gemfile.lock with the platform or without platforms", func() {
+			add, err := bundler.CheckLockPlatform(workingDir, bundler.GemfileLock{Platforms: []string{"x86_64-linux"}}, "x86_64-linux", configuration, logger)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(add).To(BeFalse())
+
+			add, err = bundler.CheckLockPlatform(workingDir, bundler.GemfileLock{}, "x86_64-linux", configuration, logger)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(add).To(BeFalse())
+			Expect(buffer.String()).To(BeEmpty())
+		})
+
+		it("fails with the policy fail", func() {
+			configuration.PlatformCheck = "fail"
+
+			_, err := bundler.CheckLockPlatform(workingDir, lock, "x86_64-linux", configuration, logger)
+			Expect(err).To(MatchError("Gemfile.lock only supports the platforms arm64-darwin but the build runs on x86_64-linux, precompiled gems for x86_64-linux would be skipped, run 'bundle lock --add-platform x86_64-linux' and commit Gemfile.lock"))
+		})
+
+		it("fails for a frozen bundle", func() {
+			Expect(os.MkdirAll(filepath.Join(workingDir, ".bundle"), os.ModePerm)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(workingDir, ".bundle", "config"), []byte("---\nBUNDLE_DEPLOYMENT: \"true\"\n"), 0644)).To(Succeed())
+
+			_, err := bundler.CheckLockPlatform(workingDir, lock, "x86_64-linux", configuration, logger)
+			Expect(err).To(MatchError("Gemfile.lock doesn't contain the platform x86_64-linux of the build and BUNDLE_DEPLOYMENT is set, Bundler would refuse to load the bundle at launch since the application's Gemfile.lock isn't changed, run 'bundle lock --add-platform x86_64-linux' and commit Gemfile.lock"))
+
+			os.Setenv("BUNDLE_DEPLOYMENT", "false")
+			defer os.Unsetenv("BUNDLE_DEPLOYMENT")
+			os.Setenv("BUNDLE_FROZEN", "true")
+			defer os.Unsetenv("BUNDLE_FROZEN")
+
+			_, err = bundler.CheckLockPlatform(workingDir, lock, "x86_64-linux", configuration, logger)
+			Expect(err).To(MatchError(ContainSubstring("BUNDLE_FROZEN is set")))
+		})
+
+		it("skips the check with the policy off", func() {
+			configuration.PlatformCheck = "off"
+
+			add, err := bundler.CheckLockPlatform(workingDir, lock, "x86_64-linux", configuration, logger)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(add).To(BeFalse())
+		})
+
+		it("fails on an invalid policy", func() {
+			configuration.PlatformCheck = "maybe"
+
+			_, err := bundler.CheckLockPlatform(workingDir, lock, "x86_64-linux", configuration, logger)
+			Expect(err).To(MatchError("invalid platform check policy 'maybe', must be one of add, fail or off"))
+		})
+	})
+
+	context("UseLockPlatform", func() {
+		var lockPath string
+
+		it.Before(func() {
+			lockPath = filepath.Join(workingDir, "Gemfile.lock")
+			Expect(ioutil.WriteFile(lockPath, []byte("PLATFORMS\n  arm64-darwin\n"), 0644)).To(Succeed())
+
+			bashCmd.RunBashCmdCall.Stub = func(command, dir string) (string, error) {
+				path := strings.Trim(command[strings.LastIndex(command, " ")+1:], "'")
+				return "", ioutil.WriteFile(path, []byte("PLATFORMS\n  arm64-darwin\n  x86_64-linux\n"), 0644)
+			}
+		})
+
+		it("adds the platform to a copy in the layer and restores the application's Gemfile.lock", func() {
+			restore, err := bundler.UseLockPlatform(workingDir, layerPath, "x86_64-linux", false, bashCmd, logger)
+			Expect(err).NotTo(HaveOccurred())
+
+			layerLockPath := filepath.Join(layerPath, "Gemfile.lock")
+			Expect(bashCmd.RunBashCmdCall.Receives.Command).To(Equal("bundle lock --add-platform x86_64-linux --lockfile '" + layerLockPath + "'"))
+			Expect(bashCmd.RunBashCmdCall.Receives.WorkingDir).To(Equal(workingDir))
+			Expect(ioutil.ReadFile(lockPath)).To(Equal([]byte("PLATFORMS\n  arm64-darwin\n  x86_64-linux\n")))
+
+			Expect(restore()).To(Succeed())
+			Expect(ioutil.ReadFile(lockPath)).To(Equal([]byte("PLATFORMS\n  arm64-darwin\n")))
+			Expect(ioutil.ReadFile(layerLockPath)).To(Equal([]byte("PLATFORMS\n  arm64-darwin\n  x86_64-linux\n")))
+		})
+
+		it("reuses the copy in the layer unless it has to be regenerated", func() {
+			Expect(ioutil.WriteFile(filepath.Join(layerPath, "Gemfile.lock"), []byte("cached"), 0644)).To(Succeed())
+
+			_, err := bundler.UseLockPlatform(workingDir, layerPath, "x86_64-linux", false, bashCmd, logger)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(bashCmd.RunBashCmdCall.CallCount).To(Equal(0))
+			Expect(ioutil.ReadFile(lockPath)).To(Equal([]byte("cached")))
+
+			_, err = bundler.UseLockPlatform(workingDir, layerPath, "x86_64-linux", true, bashCmd, logger)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(bashCmd.RunBashCmdCall.CallCount).To(Equal(1))
+		})
+
+		it("fails if bundle lock fails", func() {
+			bashCmd.RunBashCmdCall.Stub = nil
+			bashCmd.RunBashCmdCall.Returns.String = "Could not find gem"
+			bashCmd.RunBashCmdCall.Returns.Error = errors.New("exit status 1")
+
+			_, err := bundler.UseLockPlatform(workingDir, layerPath, "x86_64-linux", false, bashCmd, logger)
+			Expect(err).To(MatchError("failed to add the platform x86_64-linux to Gemfile.lock: exit status 1\nCould not find gem"))
+			Expect(ioutil.ReadFile(lockPath)).To(Equal([]byte("PLATFORMS\n  arm64-darwin\n")))
+		})
+	})
+}
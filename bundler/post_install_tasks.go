@@ -0,0 +1,153 @@
+package bundler
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/paketo-buildpacks/packit/v2"
+	"github.com/paketo-buildpacks/packit/v2/chronos"
+	"github.com/paketo-buildpacks/packit/v2/fs"
+	"github.com/paketo-buildpacks/packit/v2/scribe"
+)
+
+// RunPostInstallTasks runs the configured post-install rake tasks, e.g.
+// "assets:precompile", with "bundle exec" in the application directory.
+//
+// The configured cache directories, e.g. "public/assets", are restored from
+// the given layer, "post-install-cache" by default, before the tasks run,
+// unless the application supplies them, and are saved into the layer
+// afterwards. The returned bool reports whether the layer has been created.
+func RunPostInstallTasks(context packit.BuildContext, layerName string, configuration Configuration, bashcmd BashCmd, logger scribe.Logger) (packit.Layer, bool, error) {
+	if len(configuration.PostInstallTasks) == 0 {
+		return packit.Layer{}, false, nil
+	}
+
+	clock := chronos.DefaultClock
+
+	var cacheDirs []string
+	for _, dir := range configuration.PostInstallCacheDirs {
+		cacheDir, err := postInstallCacheDir(context.WorkingDir, dir)
+		if err != nil {
+			return packit.Layer{}, false, err
+		}
+		cacheDirs = append(cacheDirs, cacheDir)
+	}
+
+	var cacheLayer packit.Layer
+	if len(cacheDirs) > 0 {
+		var err error
+		cacheLayer, err = context.Layers.Get(layerName)
+		if err != nil {
+			return packit.Layer{}, false, err
+		}
+
+		for _, dir := range cacheDirs {
+			err = restorePostInstallCacheDir(context.WorkingDir, cacheLayer.Path, dir, logger)
+			if err != nil {
+				return packit.Layer{}, false, err
+			}
+		}
+	}
+
+	for _, task := range configuration.PostInstallTasks {
+		timeStartTask := clock.Now()
+		logger.Process("Running post-install task '%s'", task)
+
+		rakeCmd := strings.Join([]string{
+			"bundle",
+			"exec",
+			"rake",
+			task,
+		}, " ")
+		_, err := bashcmd.RunBashCmd(rakeCmd, context.WorkingDir)
+		if err != nil {
+			return packit.Layer{}, false, fmt.Errorf("post-install task '%s' failed: %w", task, err)
+		}
+
+		timeDuration := clock.Now().Sub(timeStartTask)
+		logger.Action("Completed in %s", timeDuration.Round(time.Millisecond))
+		logger.Break()
+	}
+
+	if len(cacheDirs) == 0 {
+		return packit.Layer{}, false, nil
+	}
+
+	for _, dir := range cacheDirs {
+		err := savePostInstallCacheDir(context.WorkingDir, cacheLayer.Path, dir)
+		if err != nil {
+			return packit.Layer{}, false, err
+		}
+	}
+
+	cacheLayer.Cache = true
+
+	return cacheLayer, true, nil
+}
+
+// postInstallCacheDir returns the given cache directory cleaned. It has to be
+// relative to the application and inside of it, so that it is also inside of
+// the layer it is cached in.
+func postInstallCacheDir(workingDir string, dir string) (string, error) {
+	if filepath.IsAbs(dir) {
+		return "", fmt.Errorf("invalid post-install cache directory '%s': must be relative to the application", dir)
+	}
+
+	path, err := appPath(workingDir, workingDir, dir)
+	if err != nil {
+		return "", fmt.Errorf("invalid post-install cache directory '%s': %w", dir, err)
+	}
+
+	if path == filepath.Clean(workingDir) {
+		return "", fmt.Errorf("invalid post-install cache directory '%s': must be a subdirectory of the application", dir)
+	}
+
+	return filepath.Rel(workingDir, path)
+}
+
+func restorePostInstallCacheDir(workingDir string, cachePath string, dir string, logger scribe.Logger) error {
+	source := filepath.Join(cachePath, dir)
+	destination := filepath.Join(workingDir, dir)
+
+	if !fileExists(source) {
+		return nil
+	}
+
+	if fileExists(destination) {
+		logger.Process("Not restoring '%s' from the cache because the application supplies it", dir)
+		return nil
+	}
+
+	logger.Process("Restoring '%s' from the cache", dir)
+
+	err := os.MkdirAll(filepath.Dir(destination), os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	return fs.Copy(source, destination)
+}
+
+func savePostInstallCacheDir(workingDir string, cachePath string, dir string) error {
+	source := filepath.Join(workingDir, dir)
+	destination := filepath.Join(cachePath, dir)
+
+	err := os.RemoveAll(destination)
+	if err != nil {
+		return err
+	}
+
+	if !fileExists(source) {
+		return nil
+	}
+
+	err = os.MkdirAll(filepath.Dir(destination), os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	return fs.Copy(source, destination)
+}
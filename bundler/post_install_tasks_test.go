@@ -0,0 +1,137 @@
+package bundler_test
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/avarteqgmbh/rvm-bundler-cnb/bundler"
+	"github.com/avarteqgmbh/rvm-bundler-cnb/bundler/fakes"
+	"github.com/paketo-buildpacks/packit/v2"
+	"github.com/paketo-buildpacks/packit/v2/scribe"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testPostInstallTasks(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+
+		workingDir    string
+		layersDir     string
+		bashCmd       *fakes.BashCmd
+		commands      []string
+		logger        scribe.Logger
+		ctx           packit.BuildContext
+		configuration bundler.Configuration
+	)
+
+	it.Before(func() {
+		var err error
+		workingDir, err = ioutil.TempDir("", "working-dir")
+		Expect(err).NotTo(HaveOccurred())
+
+		layersDir, err = ioutil.TempDir("", "layers")
+		Expect(err).NotTo(HaveOccurred())
+
+		commands = nil
+		bashCmd = &fakes.BashCmd{}
+		bashCmd.RunBashCmdCall.Stub = func(command string, workingDir string) (string, error) {
+			commands = append(commands, command)
+			return "", nil
+		}
+
+		logger = scribe.NewLogger(bytes.NewBuffer(nil))
+		ctx = packit.BuildContext{
+			WorkingDir: workingDir,
+			Layers:     packit.Layers{Path: layersDir},
+		}
+		configuration = bundler.Configuration{
+			PostInstallTasks:     []string{"assets:precompile", "assets:clean"},
+			PostInstallCacheDirs: []string{"public/assets"},
+		}
+	})
+
+	it.After(func() {
+		Expect(os.RemoveAll(workingDir)).To(Succeed())
+		Expect(os.RemoveAll(layersDir)).To(Succeed())
+	})
+
+	it("runs every task with bundle exec and caches the configured directories", func() {
+		bashCmd.RunBashCmdCall.Stub = func(command string, dir string) (string, error) {
+			commands = append(commands, command)
+			Expect(os.MkdirAll(filepath.Join(dir, "public", "assets"), os.ModePerm)).To(Succeed())
+			return "", ioutil.WriteFile(filepath.Join(dir, "public", "assets", "app.css"), nil, 0644)
+		}
+
+		layer, ok, err := bundler.RunPostInstallTasks(ctx, "post-install-cache", configuration, bashCmd, logger)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ok).To(BeTrue())
+
+		Expect(commands).To(Equal([]string{
+			"bundle exec rake assets:precompile",
+			"bundle exec rake assets:clean",
+		}))
+		Expect(layer.Cache).To(BeTrue())
+		Expect(layer.Launch).To(BeFalse())
+		Expect(filepath.Join(layersDir, "post-install-cache", "public", "assets", "app.css")).To(BeAnExistingFile())
+	})
+
+	it("restores the cached directories before running the tasks", func() {
+		Expect(os.MkdirAll(filepath.Join(layersDir, "post-install-cache", "public", "assets"), os.ModePerm)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(layersDir, "post-install-cache", "public", "assets", "old.css"), nil, 0644)).To(Succeed())
+
+		bashCmd.RunBashCmdCall.Stub = func(command string, dir string) (string, error) {
+			Expect(filepath.Join(dir, "public", "assets", "old.css")).To(BeAnExistingFile())
+			return "", nil
+		}
+
+		_, _, err := bundler.RunPostInstallTasks(ctx, "post-install-cache", configuration, bashCmd, logger)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	it("rejects cache directories outside of the application", func() {
+		sentinel := filepath.Join(layersDir, "sentinel")
+		Expect(ioutil.WriteFile(sentinel, nil, 0644)).To(Succeed())
+
+		configuration.PostInstallCacheDirs = []string{"public/assets", ".."}
+		_, _, err := bundler.RunPostInstallTasks(ctx, "post-install-cache", configuration, bashCmd, logger)
+		Expect(err).To(MatchError(ContainSubstring("invalid post-install cache directory '..'")))
+		Expect(err).To(MatchError(ContainSubstring("is outside of the application")))
+
+		configuration.PostInstallCacheDirs = []string{"/etc"}
+		_, _, err = bundler.RunPostInstallTasks(ctx, "post-install-cache", configuration, bashCmd, logger)
+		Expect(err).To(MatchError("invalid post-install cache directory '/etc': must be relative to the application"))
+
+		configuration.PostInstallCacheDirs = []string{"public/.."}
+		_, _, err = bundler.RunPostInstallTasks(ctx, "post-install-cache", configuration, bashCmd, logger)
+		Expect(err).To(MatchError("invalid post-install cache directory 'public/..': must be a subdirectory of the application"))
+
+		Expect(commands).To(BeEmpty())
+		Expect(sentinel).To(BeAnExistingFile())
+	})
+
+	it("does nothing without tasks", func() {
+		configuration.PostInstallTasks = nil
+
+		_, ok, err := bundler.RunPostInstallTasks(ctx, "post-install-cache", configuration, bashCmd, logger)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ok).To(BeFalse())
+		Expect(commands).To(BeEmpty())
+	})
+
+	it("returns an error naming the failed task", func() {
+		bashCmd.RunBashCmdCall.Stub = func(command string, dir string) (string, error) {
+			commands = append(commands, command)
+			return "", errors.New("exit status 1")
+		}
+
+		_, _, err := bundler.RunPostInstallTasks(ctx, "post-install-cache", configuration, bashCmd, logger)
+		Expect(err).To(MatchError("post-install task 'assets:precompile' failed: exit status 1"))
+		Expect(commands).To(HaveLen(1))
+	})
+}
@@ -0,0 +1,84 @@
+package bundler
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/paketo-buildpacks/packit/v2"
+)
+
+// InferredProcess represents a process inferred from the application together
+// with the reason it was inferred
+type InferredProcess struct {
+	packit.Process
+	Reason string
+}
+
+// workerGems lists the background job gems a "worker" process is inferred
+// for, in the order of preference
+var workerGems = []struct {
+	Name    string
+	Command string
+}{
+	{Name: "sidekiq", Command: "sidekiq"},
+	{Name: "good_job", Command: "good_job start"},
+	{Name: "solid_queue", Command: "rake solid_queue:start"},
+	{Name: "resque", Command: "rake resque:work QUEUE='*'"},
+}
+
+// WebReason returns the reason for the application to be run by a web server
+// or an empty string if the application isn't a web application
+func WebReason(workingDir string) string {
+	if isRailsApp(workingDir) {
+		return "Rails application found"
+	}
+
+	if fileExists(filepath.Join(workingDir, "config.ru")) {
+		return "config.ru found"
+	}
+
+	return ""
+}
+
+// InferProcesses returns the processes other than "web" that are suggested by
+// the application's files and the gems in its Gemfile.lock
+func InferProcesses(workingDir string, lock GemfileLock, configuration Configuration) []InferredProcess {
+	var processes []InferredProcess
+
+	for _, gem := range workerGems {
+		if lock.Has(gem.Name) {
+			processes = append(processes, InferredProcess{
+				Process: packit.Process{Type: "worker", Command: bundleExec(configuration, gem.Command)},
+				Reason:  fmt.Sprintf("%s found in Gemfile.lock", gem.Name),
+			})
+			break
+		}
+	}
+
+	if isRailsApp(workingDir) {
+		processes = append(processes, InferredProcess{
+			Process: packit.Process{Type: "console", Command: bundleExec(configuration, "rails console")},
+			Reason:  "Rails application found",
+		})
+	}
+
+	if fileExists(filepath.Join(workingDir, "Rakefile")) {
+		processes = append(processes, InferredProcess{
+			Process: packit.Process{Type: "rake", Command: bundleExec(configuration, "rake")},
+			Reason:  "Rakefile found",
+		})
+	}
+
+	return processes
+}
+
+func isRailsApp(workingDir string) bool {
+	return fileExists(filepath.Join(workingDir, "bin", "rails")) &&
+		fileExists(filepath.Join(workingDir, "config", "application.rb"))
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
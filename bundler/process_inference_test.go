@@ -0,0 +1,103 @@
+package bundler_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/avarteqgmbh/rvm-bundler-cnb/bundler"
+	"github.com/paketo-buildpacks/packit/v2"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testProcessInference(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+
+		workingDir string
+	)
+
+	it.Before(func() {
+		var err error
+		workingDir, err = ioutil.TempDir("", "working-dir")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	it.After(func() {
+		Expect(os.RemoveAll(workingDir)).To(Succeed())
+	})
+
+	context("WebReason", func() {
+		it("returns a reason for a Rack application", func() {
+			Expect(ioutil.WriteFile(filepath.Join(workingDir, "config.ru"), nil, 0644)).To(Succeed())
+
+			Expect(bundler.WebReason(workingDir)).To(Equal("config.ru found"))
+		})
+
+		it("returns a reason for a Rails application", func() {
+			Expect(os.MkdirAll(filepath.Join(workingDir, "bin"), os.ModePerm)).To(Succeed())
+			Expect(os.MkdirAll(filepath.Join(workingDir, "config"), os.ModePerm)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(workingDir, "bin", "rails"), nil, 0755)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(workingDir, "config", "application.rb"), nil, 0644)).To(Succeed())
+
+			Expect(bundler.WebReason(workingDir)).To(Equal("Rails application found"))
+		})
+
+		it("returns no reason for other applications", func() {
+			Expect(bundler.WebReason(workingDir)).To(BeEmpty())
+		})
+	})
+
+	context("InferProcesses", func() {
+		it("infers a worker, a console and a rake process", func() {
+			Expect(os.MkdirAll(filepath.Join(workingDir, "bin"), os.ModePerm)).To(Succeed())
+			Expect(os.MkdirAll(filepath.Join(workingDir, "config"), os.ModePerm)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(workingDir, "bin", "rails"), nil, 0755)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(workingDir, "config", "application.rb"), nil, 0644)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(workingDir, "Rakefile"), nil, 0644)).To(Succeed())
+
+			lock := bundler.GemfileLock{Specs: map[string]string{
+				"resque":  "2.2.1",
+				"sidekiq": "6.5.1",
+			}}
+
+			Expect(bundler.InferProcesses(workingDir, lock, bundler.Configuration{})).To(Equal([]bundler.InferredProcess{
+				{
+					Process: packit.Process{Type: "worker", Command: "bundle exec sidekiq"},
+					Reason:  "sidekiq found in Gemfile.lock",
+				},
+				{
+					Process: packit.Process{Type: "console", Command: "bundle exec rails console"},
+					Reason:  "Rails application found",
+				},
+				{
+					Process: packit.Process{Type: "rake", Command: "bundle exec rake"},
+					Reason:  "Rakefile found",
+				},
+			}))
+		})
+
+		it("infers a worker for each supported background job gem", func() {
+			commands := map[string]string{
+				"sidekiq":     "bundle exec sidekiq",
+				"good_job":    "bundle exec good_job start",
+				"solid_queue": "bundle exec rake solid_queue:start",
+				"resque":      "bundle exec rake resque:work QUEUE='*'",
+			}
+
+			for gem, command := range commands {
+				lock := bundler.GemfileLock{Specs: map[string]string{gem: "1.0.0"}}
+				processes := bundler.InferProcesses(workingDir, lock, bundler.Configuration{})
+				Expect(processes).To(HaveLen(1))
+				Expect(processes[0].Process).To(Equal(packit.Process{Type: "worker", Command: command}))
+			}
+		})
+
+		it("infers nothing for a plain Ruby application", func() {
+			Expect(bundler.InferProcesses(workingDir, bundler.GemfileLock{}, bundler.Configuration{})).To(BeEmpty())
+		})
+	})
+}
@@ -0,0 +1,82 @@
+package bundler
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/paketo-buildpacks/packit/v2"
+)
+
+var procfileEntryRegEx = regexp.MustCompile(`^([A-Za-z0-9_-]+)\s*:\s*(.+)$`)
+
+// ParseProcfile parses the Procfile at the given path and returns a
+// packit.Process for every entry in the order of their appearance. Blank
+// lines, comments and lines that aren't entries are skipped. If a process type
+// is defined more than once, the last definition wins.
+func ParseProcfile(path string) ([]packit.Process, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var processes []packit.Process
+	indices := map[string]int{}
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		matches := procfileEntryRegEx.FindStringSubmatch(line)
+		if matches == nil {
+			continue
+		}
+
+		process := packit.Process{
+			Type:    matches[1],
+			Command: strings.TrimSpace(matches[2]),
+		}
+
+		if index, ok := indices[process.Type]; ok {
+			processes[index] = process
+			continue
+		}
+
+		indices[process.Type] = len(processes)
+		processes = append(processes, process)
+	}
+
+	return processes, scanner.Err()
+}
+
+// ProcfileHasProcess reports whether the Procfile in the given directory
+// defines a process of the given type
+func ProcfileHasProcess(workingDir string, processType string) (bool, error) {
+	processes, err := ParseProcfile(filepath.Join(workingDir, "Procfile"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return hasProcess(processes, processType), nil
+}
+
+// SetDefaultProcess marks the process of the given type as the default
+// process and returns false if there is no process of that type
+func SetDefaultProcess(processes []packit.Process, processType string) bool {
+	found := false
+	for i := range processes {
+		processes[i].Default = processes[i].Type == processType
+		found = found || processes[i].Default
+	}
+
+	return found
+}
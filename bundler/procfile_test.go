@@ -0,0 +1,94 @@
+package bundler_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/avarteqgmbh/rvm-bundler-cnb/bundler"
+	"github.com/paketo-buildpacks/packit/v2"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testProcfile(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+
+		workingDir string
+		path       string
+	)
+
+	it.Before(func() {
+		var err error
+		workingDir, err = ioutil.TempDir("", "working-dir")
+		Expect(err).NotTo(HaveOccurred())
+
+		path = filepath.Join(workingDir, "Procfile")
+	})
+
+	it.After(func() {
+		Expect(os.RemoveAll(workingDir)).To(Succeed())
+	})
+
+	context("ParseProcfile", func() {
+		it("returns every entry of the Procfile", func() {
+			procfile := `# processes of some app
+web: bundle exec puma -C config/puma.rb
+
+  worker:bundle exec sidekiq
+release :  bundle exec rake db:migrate
+not an entry
+clock: bundle exec clockwork clock.rb # runs scheduled jobs
+web: bundle exec puma
+`
+			Expect(ioutil.WriteFile(path, []byte(procfile), 0644)).To(Succeed())
+
+			processes, err := bundler.ParseProcfile(path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(processes).To(Equal([]packit.Process{
+				{Type: "web", Command: "bundle exec puma"},
+				{Type: "worker", Command: "bundle exec sidekiq"},
+				{Type: "release", Command: "bundle exec rake db:migrate"},
+				{Type: "clock", Command: "bundle exec clockwork clock.rb # runs scheduled jobs"},
+			}))
+		})
+
+		it("returns no processes for an empty Procfile", func() {
+			Expect(ioutil.WriteFile(path, nil, 0644)).To(Succeed())
+
+			processes, err := bundler.ParseProcfile(path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(processes).To(BeEmpty())
+		})
+
+		it("returns an error if the Procfile doesn't exist", func() {
+			_, err := bundler.ParseProcfile(path)
+			Expect(os.IsNotExist(err)).To(BeTrue())
+		})
+	})
+
+	context("SetDefaultProcess", func() {
+		it("marks only the process of the given type as default", func() {
+			processes := []packit.Process{
+				{Type: "web", Command: "bundle exec puma", Default: true},
+				{Type: "worker", Command: "bundle exec sidekiq"},
+			}
+
+			Expect(bundler.SetDefaultProcess(processes, "worker")).To(BeTrue())
+			Expect(processes[0].Default).To(BeFalse())
+			Expect(processes[1].Default).To(BeTrue())
+		})
+
+		it("returns false if there is no process of the given type", func() {
+			processes := []packit.Process{
+				{Type: "worker", Command: "bundle exec sidekiq"},
+			}
+
+			Expect(bundler.SetDefaultProcess(processes, "web")).To(BeFalse())
+			Expect(processes[0].Default).To(BeFalse())
+		})
+	})
+}
@@ -0,0 +1,259 @@
+package bundler
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/paketo-buildpacks/packit/v2/scribe"
+)
+
+// PruneBundle removes the files of the installed gems that aren't needed at
+// runtime, if pruning is enabled. Paths are matched relative to the gem
+// directories of the layer, e.g. "ruby/3.1.0", against the prune patterns,
+// unless they match one of the patterns to keep. A "**" matches any number
+// of directories. Debug symbols are stripped from native extensions if
+// enabled. The layer has to pass "bundle check" afterwards.
+func PruneBundle(layerPath, workingDir string, configuration Configuration, bashcmd BashCmd, logger scribe.Logger) error {
+	if !configuration.Prune && !configuration.StripDebug {
+		return nil
+	}
+
+	gemDirs, err := filepath.Glob(filepath.Join(layerPath, "*", "*", "specifications"))
+	if err != nil {
+		return err
+	}
+
+	var saved int64
+	if configuration.Prune {
+		logger.Process("Pruning the installed gems")
+
+		for _, specifications := range gemDirs {
+			pruned, err := pruneGemDir(filepath.Dir(specifications), configuration.PrunePatterns, configuration.PruneKeep)
+			if err != nil {
+				return err
+			}
+			saved += pruned
+		}
+	}
+
+	if configuration.StripDebug {
+		stripped, err := stripDebugSymbols(layerPath, workingDir, bashcmd, logger)
+		if err != nil {
+			return err
+		}
+		saved += stripped
+	}
+
+	bundleCheckCmd := strings.Join([]string{
+		"bundle",
+		"check",
+	}, " ")
+	output, err := bashcmd.RunBashCmd(bundleCheckCmd, workingDir)
+	if err != nil {
+		return fmt.Errorf("the pruned bundle failed '%s': %w\n%s", bundleCheckCmd, err, output)
+	}
+
+	logger.Action("Pruning saved %s", formatBytes(saved))
+	logger.Break()
+
+	return nil
+}
+
+// pruneGemDir removes the paths matching the prune patterns from the given
+// gem directory and returns the number of bytes removed
+func pruneGemDir(gemDir string, patterns, keep []string) (int64, error) {
+	var saved int64
+
+	err := filepath.Walk(gemDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(gemDir, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		if rel == "." {
+			return nil
+		}
+
+		if matchesAny(keep, rel) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if !matchesAny(patterns, rel) {
+			return nil
+		}
+
+		size, err := pathSize(path)
+		if err != nil {
+			return err
+		}
+
+		err = os.RemoveAll(path)
+		if err != nil {
+			return err
+		}
+		saved += size
+
+		if info.IsDir() {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return saved, nil
+}
+
+// stripDebugSymbols strips the debug symbols from the native extensions in
+// the given layer and returns the number of bytes removed
+func stripDebugSymbols(layerPath, workingDir string, bashcmd BashCmd, logger scribe.Logger) (int64, error) {
+	var files []string
+	err := filepath.Walk(layerPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.Mode().IsRegular() && strings.HasSuffix(path, ".so") {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if len(files) == 0 {
+		return 0, nil
+	}
+
+	_, err = bashcmd.RunBashCmd("command -v strip", workingDir)
+	if err != nil {
+		logger.Process("Not stripping debug symbols because strip is not available")
+		return 0, nil
+	}
+
+	logger.Process("Stripping debug symbols from %d native extensions", len(files))
+
+	var before int64
+	for _, file := range files {
+		size, err := pathSize(file)
+		if err != nil {
+			return 0, err
+		}
+		before += size
+	}
+
+	stripCmd := []string{
+		"strip",
+		"--strip-debug",
+	}
+	for _, file := range files {
+		stripCmd = append(stripCmd, shellQuote(file))
+	}
+	_, err = bashcmd.RunBashCmd(strings.Join(stripCmd, " "), workingDir)
+	if err != nil {
+		return 0, err
+	}
+
+	var after int64
+	for _, file := range files {
+		size, err := pathSize(file)
+		if err != nil {
+			return 0, err
+		}
+		after += size
+	}
+
+	return before - after, nil
+}
+
+// matchesAny reports whether the slash separated path matches one of the
+// patterns
+func matchesAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if matchPattern(strings.Split(pattern, "/"), strings.Split(name, "/")) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchPattern matches path segments against pattern segments, "**" matches
+// any number of segments
+func matchPattern(pattern, name []string) bool {
+	if len(pattern) == 0 {
+		return len(name) == 0
+	}
+
+	if pattern[0] == "**" {
+		for i := 0; i <= len(name); i++ {
+			if matchPattern(pattern[1:], name[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if len(name) == 0 {
+		return false
+	}
+
+	ok, err := path.Match(pattern[0], name[0])
+	if err != nil || !ok {
+		return false
+	}
+
+	return matchPattern(pattern[1:], name[1:])
+}
+
+// pathSize returns the size of a file or the total size of the files in a
+// directory
+func pathSize(root string) (int64, error) {
+	var size int64
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+
+	return size, err
+}
+
+// formatBytes formats a number of bytes for the build log
+func formatBytes(bytes int64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+
+	div, exp := int64(unit), 0
+	for n := bytes / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f %ciB", float64(bytes)/float64(div), "KMGTPE"[exp])
+}
+
+// shellQuote quotes a string for use as a single word in a bash command
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
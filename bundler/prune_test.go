@@ -0,0 +1,124 @@
+package bundler_test
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/avarteqgmbh/rvm-bundler-cnb/bundler"
+	"github.com/avarteqgmbh/rvm-bundler-cnb/bundler/fakes"
+	"github.com/paketo-buildpacks/packit/v2/scribe"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testPrune(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+
+		layerPath     string
+		gemDir        string
+		bashCmd       *fakes.BashCmd
+		buffer        *bytes.Buffer
+		logger        scribe.Logger
+		configuration bundler.Configuration
+	)
+
+	it.Before(func() {
+		var err error
+		layerPath, err = ioutil.TempDir("", "layer")
+		Expect(err).NotTo(HaveOccurred())
+
+		gemDir = filepath.Join(layerPath, "ruby", "3.1.0")
+		for _, dir := range []string{
+			"specifications",
+			"cache",
+			"gems/puma-5.6.4/lib/puma",
+			"gems/puma-5.6.4/ext/puma_http11",
+			"gems/puma-5.6.4/test",
+			"gems/json-2.6.2/ext/json",
+		} {
+			Expect(os.MkdirAll(filepath.Join(gemDir, dir), os.ModePerm)).To(Succeed())
+		}
+
+		for _, file := range []string{
+			"cache/puma-5.6.4.gem",
+			"gems/puma-5.6.4/lib/puma.rb",
+			"gems/puma-5.6.4/lib/puma/puma_http11.so",
+			"gems/puma-5.6.4/lib/puma/mini_ssl.o",
+			"gems/puma-5.6.4/ext/puma_http11/http11_parser.o",
+			"gems/puma-5.6.4/test/test_puma.rb",
+			"gems/json-2.6.2/ext/json/generator.rb",
+		} {
+			Expect(ioutil.WriteFile(filepath.Join(gemDir, file), []byte(strings.Repeat("x", 512)), 0644)).To(Succeed())
+		}
+
+		bashCmd = &fakes.BashCmd{}
+		buffer = bytes.NewBuffer(nil)
+		logger = scribe.NewLogger(buffer)
+		configuration = bundler.Configuration{
+			Prune:         true,
+			PrunePatterns: []string{"cache/*.gem", "gems/*/ext", "gems/*/test", "**/*.o"},
+			PruneKeep:     []string{"gems/json-*/ext"},
+		}
+	})
+
+	it.After(func() {
+		Expect(os.RemoveAll(layerPath)).To(Succeed())
+	})
+
+	it("removes the files matching the prune patterns", func() {
+		err := bundler.PruneBundle(layerPath, "/working-dir", configuration, bashCmd, logger)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(filepath.Join(gemDir, "cache", "puma-5.6.4.gem")).NotTo(BeAnExistingFile())
+		Expect(filepath.Join(gemDir, "gems", "puma-5.6.4", "ext")).NotTo(BeADirectory())
+		Expect(filepath.Join(gemDir, "gems", "puma-5.6.4", "test")).NotTo(BeADirectory())
+		Expect(filepath.Join(gemDir, "gems", "puma-5.6.4", "lib", "puma", "mini_ssl.o")).NotTo(BeAnExistingFile())
+
+		Expect(filepath.Join(gemDir, "gems", "puma-5.6.4", "lib", "puma.rb")).To(BeAnExistingFile())
+		Expect(filepath.Join(gemDir, "gems", "puma-5.6.4", "lib", "puma", "puma_http11.so")).To(BeAnExistingFile())
+		Expect(filepath.Join(gemDir, "gems", "json-2.6.2", "ext", "json", "generator.rb")).To(BeAnExistingFile())
+
+		Expect(bashCmd.RunBashCmdCall.Receives.Command).To(Equal("bundle check"))
+		Expect(buffer.String()).To(ContainSubstring("Pruning saved 2.0 KiB"))
+	})
+
+	it("strips the debug symbols of native extensions if enabled", func() {
+		configuration = bundler.Configuration{StripDebug: true}
+		commands := []string{}
+		bashCmd.RunBashCmdCall.Stub = func(command, dir string) (string, error) {
+			commands = append(commands, command)
+			return "", nil
+		}
+
+		err := bundler.PruneBundle(layerPath, "/working-dir", configuration, bashCmd, logger)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(commands).To(Equal([]string{
+			"command -v strip",
+			"strip --strip-debug '" + filepath.Join(gemDir, "gems", "puma-5.6.4", "lib", "puma", "puma_http11.so") + "'",
+			"bundle check",
+		}))
+		Expect(filepath.Join(gemDir, "cache", "puma-5.6.4.gem")).To(BeAnExistingFile())
+	})
+
+	it("does nothing if pruning is disabled", func() {
+		err := bundler.PruneBundle(layerPath, "/working-dir", bundler.Configuration{}, bashCmd, logger)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(filepath.Join(gemDir, "cache", "puma-5.6.4.gem")).To(BeAnExistingFile())
+		Expect(bashCmd.RunBashCmdCall.CallCount).To(Equal(0))
+	})
+
+	it("returns an error if the pruned bundle fails bundle check", func() {
+		bashCmd.RunBashCmdCall.Returns.String = "The following gems are missing"
+		bashCmd.RunBashCmdCall.Returns.Error = errors.New("exit status 1")
+
+		err := bundler.PruneBundle(layerPath, "/working-dir", configuration, bashCmd, logger)
+		Expect(err).To(MatchError("the pruned bundle failed 'bundle check': exit status 1\nThe following gems are missing"))
+	})
+}
@@ -6,12 +6,15 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
-	"strings"
 
 	"github.com/paketo-buildpacks/packit/v2"
 	"github.com/paketo-buildpacks/packit/v2/scribe"
 )
 
+// gemfilePumaRegex matches a Gemfile line declaring the Puma gem, e.g.
+// `gem "puma", "~> 6.0"`
+var gemfilePumaRegex = regexp.MustCompile(`^\s*gem\s*\(?\s*["']puma["']`)
+
 // PumaGemInstaller represents a new puma gem installer
 type PumaGemInstaller struct{}
 
@@ -20,16 +23,40 @@ func NewPumaInstaller() PumaGemInstaller {
 	return PumaGemInstaller{}
 }
 
-// InstallPuma install the Puma gem and creates a workingDir/config/puma.rb if
-// the file doesn't exist already
+// InstallPuma adds the Puma gem to the Gemfile unless it declares Puma
+// already and creates a workingDir/config/puma.rb if the file doesn't exist
+// already and the Procfile doesn't define the process of type "web" itself. Nothing is installed if the application isn't a web
+// application or is going to be run with a web server other than Puma.
 func (p PumaGemInstaller) InstallPuma(context packit.BuildContext, configuration Configuration, logger scribe.Logger) error {
 	if !configuration.InstallPuma {
 		return nil
 	}
 
+	if WebReason(context.WorkingDir) == "" {
+		logger.Process("Not installing Puma because the application has neither a config.ru nor is it a Rails application")
+		return nil
+	}
+
+	server, err := SelectWebServer(context.WorkingDir, configuration)
+	if err != nil {
+		return err
+	}
+
+	if server != WebServerPuma {
+		logger.Process("Not installing Puma because the web server '%s' is used", server)
+		return nil
+	}
+
+	procfileWeb, err := ProcfileHasProcess(context.WorkingDir, "web")
+	if err != nil {
+		return err
+	}
+
 	configPumaRbPath := filepath.Join(context.WorkingDir, "config", "puma.rb")
-	_, err := os.Stat(configPumaRbPath)
-	if os.IsNotExist(err) {
+	_, err = os.Stat(configPumaRbPath)
+	if procfileWeb {
+		logger.Process("Not creating config/puma.rb because the Procfile defines the process type 'web'")
+	} else if os.IsNotExist(err) {
 		logger.Process("Creating configuration file for Puma at: '%s'", configPumaRbPath)
 
 		configPumaRb, err := os.OpenFile(configPumaRbPath, os.O_RDWR|os.O_CREATE, 0644)
@@ -55,24 +82,24 @@ func (p PumaGemInstaller) InstallPuma(context packit.BuildContext, configuration
 
 	logger.Process("Using config/puma.rb supplied by application")
 
-	GemfileLock, err := os.Open(filepath.Join(context.WorkingDir, "Gemfile.lock"))
+	gemfile := FindGemfile(context.WorkingDir)
+
+	// The Gemfile.lock doesn't tell whether Puma still has to be added, a
+	// lockfile generated by a previous build lists the Puma added back then
+	declared, err := gemfileDeclaresPuma(gemfile.Path)
 	if err != nil {
 		return err
 	}
-	defer GemfileLock.Close()
 
-	scanner := bufio.NewScanner(GemfileLock)
-	for scanner.Scan() {
-		if strings.HasPrefix(strings.TrimSpace(scanner.Text()), "puma (") {
-			logger.Process("Puma is present in Gemfile.lock")
-			logger.Break()
-			return nil
-		}
+	if declared {
+		logger.Process("Puma is present in Gemfile")
+		logger.Break()
+		return nil
 	}
 
 	logger.Process("Adding Puma version: '%s' to Gemfile", configuration.Puma.Version)
 
-	Gemfile, err := os.OpenFile(filepath.Join(context.WorkingDir, "Gemfile"), os.O_APPEND|os.O_WRONLY, 0644)
+	Gemfile, err := os.OpenFile(gemfile.Path, os.O_APPEND|os.O_WRONLY, 0644)
 	if err != nil {
 		return err
 	}
@@ -86,34 +113,59 @@ func (p PumaGemInstaller) InstallPuma(context packit.BuildContext, configuration
 	return nil
 }
 
-// CreatePumaProcess creates a packit.Process if this buildpack is configured
-// to do so. If there is a Procfile in the application's directory and it
-// it contains a process of type "web:", then no packit.Process will be returned
+// gemfileDeclaresPuma returns true if the Gemfile at the given path declares
+// the Puma gem
+func gemfileDeclaresPuma(path string) (bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if gemfilePumaRegex.MatchString(scanner.Text()) {
+			return true, nil
+		}
+	}
+
+	return false, scanner.Err()
+}
+
+// CreatePumaProcess creates a packit.Process running the web server selected
+// by SelectWebServer. If the application isn't a web application or there is
+// a Procfile in the application's directory and it contains a process of type
+// "web:", then no packit.Process will be returned
 func (p PumaGemInstaller) CreatePumaProcess(context packit.BuildContext, configuration Configuration, logger scribe.Logger) (packit.Process, error) {
 	installPumaCommand := true
-	procfile, err := os.Open(filepath.Join(context.WorkingDir, "Procfile"))
-	if err == nil {
-		defer procfile.Close()
-
-		scanner := bufio.NewScanner(procfile)
-		r, _ := regexp.Compile("^web:.*$")
-		for scanner.Scan() {
-			matched := r.MatchString(strings.TrimSpace(scanner.Text()))
-			if err == nil && matched {
-				installPumaCommand = false
-				logger.Process("Do not return a process because a Procfile with process type 'web' already exists")
-			}
+	procfileProcesses, err := ParseProcfile(filepath.Join(context.WorkingDir, "Procfile"))
+	if err != nil && !os.IsNotExist(err) {
+		return packit.Process{}, err
+	}
+
+	for _, process := range procfileProcesses {
+		if process.Type == "web" {
+			installPumaCommand = false
+			logger.Process("Do not return a process because a Procfile with process type 'web' already exists")
 		}
 	}
 
+	reason := WebReason(context.WorkingDir)
+	if installPumaCommand && reason == "" {
+		installPumaCommand = false
+		logger.Process("Do not return a process of type 'web' because the application has neither a config.ru nor is it a Rails application")
+	}
+
 	if installPumaCommand {
-		logger.Process("Returning process type 'web' with command 'bundle exec puma'")
+		server, err := SelectWebServer(context.WorkingDir, configuration)
+		if err != nil {
+			return packit.Process{}, err
+		}
+
+		process := WebServerProcess(server, configuration)
+		logger.Process("Returning process type 'web' with command '%s' (%s)", process.Command, reason)
 
-		return packit.Process{
-			Type:    "web",
-			Command: "bundle exec puma",
-			Default: true,
-		}, nil
+		return process, nil
 	}
 
 	return packit.Process{}, nil
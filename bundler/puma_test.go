@@ -2,6 +2,7 @@ package bundler_test
 
 import (
 	"bytes"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -71,6 +72,9 @@ func testPuma(t *testing.T, context spec.G, it spec.S) {
 			err = os.MkdirAll(filepath.Join(workingDir, "config"), 0700)
 			Expect(err).NotTo(HaveOccurred())
 
+			err = ioutil.WriteFile(filepath.Join(workingDir, "config.ru"), emptyBuffer, 0644)
+			Expect(err).NotTo(HaveOccurred())
+
 			err = ioutil.WriteFile(filepath.Join(workingDir, "Gemfile.lock"), emptyBuffer, 0644)
 			Expect(err).NotTo(HaveOccurred())
 
@@ -92,19 +96,98 @@ func testPuma(t *testing.T, context spec.G, it spec.S) {
 
 			err = puma.InstallPuma(ctx, configuration, logger)
 			Expect(err).NotTo(HaveOccurred())
+			Expect(filepath.Join(workingDir, "config", "puma.rb")).To(BeAnExistingFile())
 
 			Expect(os.RemoveAll(workingDir)).To(Succeed())
 		})
 
-		it("creates config/puma.rb when it doesn't exist and Gemfile.lock contains puma version", func() {
+		it("doesn't add Puma to a Gemfile declaring it", func() {
+			workingDir, err := ioutil.TempDir("", "working-dir")
+			Expect(err).NotTo(HaveOccurred())
+			defer os.RemoveAll(workingDir)
+
+			Expect(os.MkdirAll(filepath.Join(workingDir, "config"), 0700)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(workingDir, "config.ru"), emptyBuffer, 0644)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(workingDir, "Gemfile.lock"), []byte("GEM\n  specs:\n    puma (2.0.0)\n"), 0644)).To(Succeed())
+			gemfile := "source \"https://rubygems.org\"\n\ngroup :web do\n  gem 'puma', '~> 2.0'\nend\n"
+			Expect(ioutil.WriteFile(filepath.Join(workingDir, "Gemfile"), []byte(gemfile), 0644)).To(Succeed())
+
+			ctx = packit.BuildContext{
+				WorkingDir: workingDir,
+				CNBPath:    cnbDir,
+				Stack:      "some-stack",
+				Layers:     packit.Layers{Path: layersDir},
+			}
+
+			puma = bundler.NewPumaInstaller()
+
+			err = puma.InstallPuma(ctx, configuration, logger)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(filepath.Join(workingDir, "config", "puma.rb")).To(BeAnExistingFile())
+			Expect(os.ReadFile(filepath.Join(workingDir, "Gemfile"))).To(Equal([]byte(gemfile)))
+		})
+
+		it("adds Puma to a Gemfile not declaring it although Gemfile.lock lists it", func() {
+			workingDir, err := ioutil.TempDir("", "working-dir")
+			Expect(err).NotTo(HaveOccurred())
+			defer os.RemoveAll(workingDir)
+
+			Expect(os.MkdirAll(filepath.Join(workingDir, "config"), 0700)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(workingDir, "config.ru"), emptyBuffer, 0644)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(workingDir, "Gemfile.lock"), []byte("GEM\n  specs:\n    puma (2.0.0)\n\nDEPENDENCIES\n  puma (= 2.0.0)\n"), 0644)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(workingDir, "Gemfile"), []byte("# gem \"puma\"\n"), 0644)).To(Succeed())
+
+			ctx = packit.BuildContext{
+				WorkingDir: workingDir,
+				CNBPath:    cnbDir,
+				Stack:      "some-stack",
+				Layers:     packit.Layers{Path: layersDir},
+			}
+
+			puma = bundler.NewPumaInstaller()
+
+			err = puma.InstallPuma(ctx, configuration, logger)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(os.ReadFile(filepath.Join(workingDir, "Gemfile"))).To(ContainSubstring(fmt.Sprintf("gem \"puma\", \"%s\"", configuration.Puma.Version)))
+		})
+
+		it("creates no config/puma.rb if the Procfile defines the web process", func() {
 			workingDir, err := ioutil.TempDir("", "working-dir")
 			Expect(err).NotTo(HaveOccurred())
 
 			err = os.MkdirAll(filepath.Join(workingDir, "config"), 0700)
 			Expect(err).NotTo(HaveOccurred())
 
-			filledBuffer := []byte("puma (2.0.0)")
-			err = ioutil.WriteFile(filepath.Join(workingDir, "Gemfile.lock"), filledBuffer, 0644)
+			err = ioutil.WriteFile(filepath.Join(workingDir, "config.ru"), emptyBuffer, 0644)
+			Expect(err).NotTo(HaveOccurred())
+
+			err = ioutil.WriteFile(filepath.Join(workingDir, "Procfile"), []byte("web: bundle exec puma -C puma.conf.rb\n"), 0644)
+			Expect(err).NotTo(HaveOccurred())
+
+			err = ioutil.WriteFile(filepath.Join(workingDir, "Gemfile.lock"), []byte("puma (2.0.0)"), 0644)
+			Expect(err).NotTo(HaveOccurred())
+
+			err = ioutil.WriteFile(filepath.Join(workingDir, "Gemfile"), emptyBuffer, 0644)
+			Expect(err).NotTo(HaveOccurred())
+
+			ctx = packit.BuildContext{
+				WorkingDir: workingDir,
+				CNBPath:    cnbDir,
+				Stack:      "some-stack",
+				Layers:     packit.Layers{Path: layersDir},
+			}
+
+			puma = bundler.NewPumaInstaller()
+
+			err = puma.InstallPuma(ctx, configuration, logger)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(filepath.Join(workingDir, "config", "puma.rb")).NotTo(BeAnExistingFile())
+
+			Expect(os.RemoveAll(workingDir)).To(Succeed())
+		})
+
+		it("installs nothing when the application isn't a web application", func() {
+			workingDir, err := ioutil.TempDir("", "working-dir")
 			Expect(err).NotTo(HaveOccurred())
 
 			err = ioutil.WriteFile(filepath.Join(workingDir, "Gemfile"), emptyBuffer, 0644)
@@ -125,6 +208,11 @@ func testPuma(t *testing.T, context spec.G, it spec.S) {
 
 			err = puma.InstallPuma(ctx, configuration, logger)
 			Expect(err).NotTo(HaveOccurred())
+			Expect(filepath.Join(workingDir, "config", "puma.rb")).NotTo(BeAnExistingFile())
+
+			gemfile, err := ioutil.ReadFile(filepath.Join(workingDir, "Gemfile"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(gemfile).To(BeEmpty())
 
 			Expect(os.RemoveAll(workingDir)).To(Succeed())
 		})
@@ -140,6 +228,9 @@ func testPuma(t *testing.T, context spec.G, it spec.S) {
 			err = os.MkdirAll(filepath.Join(workingDir, "config"), 0700)
 			Expect(err).NotTo(HaveOccurred())
 
+			err = ioutil.WriteFile(filepath.Join(workingDir, "config.ru"), emptyBuffer, 0644)
+			Expect(err).NotTo(HaveOccurred())
+
 			err = ioutil.WriteFile(filepath.Join(workingDir, "Gemfile.lock"), emptyBuffer, 0644)
 			Expect(err).NotTo(HaveOccurred())
 
@@ -211,6 +302,9 @@ func testPuma(t *testing.T, context spec.G, it spec.S) {
 			err = os.MkdirAll(filepath.Join(workingDir, "config"), 0700)
 			Expect(err).NotTo(HaveOccurred())
 
+			err = ioutil.WriteFile(filepath.Join(workingDir, "config.ru"), emptyBuffer, 0644)
+			Expect(err).NotTo(HaveOccurred())
+
 			ctx = packit.BuildContext{
 				WorkingDir: workingDir,
 				CNBPath:    cnbDir,
@@ -236,6 +330,9 @@ func testPuma(t *testing.T, context spec.G, it spec.S) {
 			err = os.MkdirAll(filepath.Join(workingDir, "config"), 0700)
 			Expect(err).NotTo(HaveOccurred())
 
+			err = ioutil.WriteFile(filepath.Join(workingDir, "config.ru"), emptyBuffer, 0644)
+			Expect(err).NotTo(HaveOccurred())
+
 			err = ioutil.WriteFile(filepath.Join(workingDir, "Gemfile.lock"), emptyBuffer, 0644)
 			Expect(err).NotTo(HaveOccurred())
 
@@ -284,6 +381,9 @@ func testPuma(t *testing.T, context spec.G, it spec.S) {
 			err = ioutil.WriteFile(filepath.Join(workingDir, "Procfile"), emptyBuffer, 0644)
 			Expect(err).NotTo(HaveOccurred())
 
+			err = ioutil.WriteFile(filepath.Join(workingDir, "config.ru"), emptyBuffer, 0644)
+			Expect(err).NotTo(HaveOccurred())
+
 			ctx = packit.BuildContext{
 				WorkingDir: workingDir,
 				CNBPath:    cnbDir,
@@ -295,10 +395,40 @@ func testPuma(t *testing.T, context spec.G, it spec.S) {
 				},
 			}
 
+			configuration.InstallPuma = true
 			puma = bundler.NewPumaInstaller()
 
-			_, err = puma.CreatePumaProcess(ctx, configuration, logger)
+			process, err := puma.CreatePumaProcess(ctx, configuration, logger)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(process).To(Equal(packit.Process{
+				Type:    "web",
+				Command: "bundle exec puma",
+				Default: true,
+			}))
+
+			Expect(os.RemoveAll(workingDir)).To(Succeed())
+		})
+
+		it("returns no process when the application isn't a web application", func() {
+			workingDir, err := ioutil.TempDir("", "working-dir")
+			Expect(err).NotTo(HaveOccurred())
+
+			ctx = packit.BuildContext{
+				WorkingDir: workingDir,
+				CNBPath:    cnbDir,
+				Stack:      "some-stack",
+				Layers:     packit.Layers{Path: layersDir},
+				BuildpackInfo: packit.BuildpackInfo{
+					Name:    "Some Buildpack",
+					Version: "1.2.3",
+				},
+			}
+
+			puma = bundler.NewPumaInstaller()
+
+			process, err := puma.CreatePumaProcess(ctx, configuration, logger)
 			Expect(err).NotTo(HaveOccurred())
+			Expect(process).To(Equal(packit.Process{}))
 
 			Expect(os.RemoveAll(workingDir)).To(Succeed())
 		})
@@ -0,0 +1,118 @@
+package bundler
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultModificationTime is the modification time of the files of a
+// reproducible layer if SOURCE_DATE_EPOCH isn't set. It is the time the
+// lifecycle uses for the files of exported layers.
+var DefaultModificationTime = time.Date(1980, time.January, 1, 0, 0, 1, 0, time.UTC)
+
+// SourceDateEpoch returns the time set in SOURCE_DATE_EPOCH, if it is set
+func SourceDateEpoch() (time.Time, bool, error) {
+	env, ok := os.LookupEnv("SOURCE_DATE_EPOCH")
+	if !ok || env == "" {
+		return time.Time{}, false, nil
+	}
+
+	seconds, err := strconv.ParseInt(env, 10, 64)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("invalid value of SOURCE_DATE_EPOCH: %w", err)
+	}
+
+	return time.Unix(seconds, 0).UTC(), true, nil
+}
+
+// NormalizeLayer makes the contents of the given layer reproducible. The
+// Bundler configuration is sorted and the modification times of all files
+// and directories are set to the given time.
+func NormalizeLayer(layerPath string, modificationTime time.Time) error {
+	err := sortBundlerConfig(filepath.Join(layerPath, "config"))
+	if err != nil {
+		return err
+	}
+
+	return normalizeModificationTimes(layerPath, modificationTime)
+}
+
+// normalizeModificationTimes sets the modification times of the files and
+// directories below the given path to the given time
+func normalizeModificationTimes(root string, modificationTime time.Time) error {
+	var paths []string
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.Mode()&os.ModeSymlink == 0 {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	// Files are changed before their directories, changing a file doesn't
+	// change the modification time of its directory but creating one does.
+	for i := len(paths) - 1; i >= 0; i-- {
+		err = os.Chtimes(paths[i], modificationTime, modificationTime)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// sortBundlerConfig sorts the settings of a Bundler configuration file. Lines
+// that are indented belong to the setting before them.
+func sortBundlerConfig(path string) error {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	lines := strings.Split(strings.TrimRight(string(contents), "\n"), "\n")
+
+	var header []string
+	if len(lines) > 0 && lines[0] == "---" {
+		header, lines = lines[:1], lines[1:]
+	}
+
+	var settings []string
+	for _, line := range lines {
+		if len(settings) > 0 && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "-")) {
+			settings[len(settings)-1] += "\n" + line
+			continue
+		}
+		settings = append(settings, line)
+	}
+	sort.Strings(settings)
+
+	sorted := strings.Join(append(header, settings...), "\n") + "\n"
+	if sorted == string(contents) {
+		return nil
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, []byte(sorted), info.Mode())
+}
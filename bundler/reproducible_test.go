@@ -0,0 +1,95 @@
+package bundler_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/avarteqgmbh/rvm-bundler-cnb/bundler"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testReproducible(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+
+		layerPath string
+	)
+
+	it.Before(func() {
+		var err error
+		layerPath, err = ioutil.TempDir("", "layer")
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(os.MkdirAll(filepath.Join(layerPath, "ruby", "3.1.0", "gems", "rack-2.2.4"), os.ModePerm)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(layerPath, "ruby", "3.1.0", "gems", "rack-2.2.4", "rack.rb"), nil, 0644)).To(Succeed())
+		Expect(os.Symlink("ruby", filepath.Join(layerPath, "current"))).To(Succeed())
+	})
+
+	it.After(func() {
+		Expect(os.RemoveAll(layerPath)).To(Succeed())
+		os.Unsetenv("SOURCE_DATE_EPOCH")
+	})
+
+	context("SourceDateEpoch", func() {
+		it("returns the time set in SOURCE_DATE_EPOCH", func() {
+			os.Setenv("SOURCE_DATE_EPOCH", "1666000000")
+
+			epoch, ok, err := bundler.SourceDateEpoch()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ok).To(BeTrue())
+			Expect(epoch).To(Equal(time.Date(2022, time.October, 17, 9, 46, 40, 0, time.UTC)))
+		})
+
+		it("reports that SOURCE_DATE_EPOCH isn't set", func() {
+			_, ok, err := bundler.SourceDateEpoch()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ok).To(BeFalse())
+		})
+
+		it("returns an error for an invalid value", func() {
+			os.Setenv("SOURCE_DATE_EPOCH", "yesterday")
+
+			_, _, err := bundler.SourceDateEpoch()
+			Expect(err).To(MatchError(ContainSubstring("invalid value of SOURCE_DATE_EPOCH")))
+		})
+	})
+
+	context("NormalizeLayer", func() {
+		it("sets the modification times of the files and directories", func() {
+			err := bundler.NormalizeLayer(layerPath, bundler.DefaultModificationTime)
+			Expect(err).NotTo(HaveOccurred())
+
+			for _, path := range []string{
+				layerPath,
+				filepath.Join(layerPath, "ruby", "3.1.0", "gems"),
+				filepath.Join(layerPath, "ruby", "3.1.0", "gems", "rack-2.2.4", "rack.rb"),
+			} {
+				info, err := os.Stat(path)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(info.ModTime().UTC()).To(Equal(bundler.DefaultModificationTime))
+			}
+		})
+
+		it("sorts the Bundler configuration", func() {
+			config := "---\nBUNDLE_PATH: \"/layers/rvm-bundler\"\nBUNDLE_BIN: \"bin\"\nBUNDLE_DEPLOYMENT: \"true\"\n"
+			Expect(ioutil.WriteFile(filepath.Join(layerPath, "config"), []byte(config), 0644)).To(Succeed())
+
+			err := bundler.NormalizeLayer(layerPath, bundler.DefaultModificationTime)
+			Expect(err).NotTo(HaveOccurred())
+
+			contents, err := ioutil.ReadFile(filepath.Join(layerPath, "config"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(contents)).To(Equal("---\nBUNDLE_BIN: \"bin\"\nBUNDLE_DEPLOYMENT: \"true\"\nBUNDLE_PATH: \"/layers/rvm-bundler\"\n"))
+		})
+
+		it("does nothing if the layer doesn't exist", func() {
+			err := bundler.NormalizeLayer(filepath.Join(layerPath, "missing"), bundler.DefaultModificationTime)
+			Expect(err).NotTo(HaveOccurred())
+		})
+	})
+}
@@ -0,0 +1,114 @@
+package bundler
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"github.com/Masterminds/semver/v3"
+)
+
+// Cache key sensitivities of the Ruby version
+const (
+	SensitivityPatch = "patch"
+	SensitivityMinor = "minor"
+	SensitivityMajor = "major"
+)
+
+// rubyVersionRegex matches Ruby versions like "ruby-3.1.2", "jruby-9.4.3.0",
+// "truffleruby-23.1.2", "ruby-3.4.0-preview1" or "ruby-head"
+var rubyVersionRegex = regexp.MustCompile(`\b(ruby|jruby|truffleruby)-(?:(head)|(\d+)\.(\d+)(?:\.(\d+))?(?:\.(\d+))?(?:-(preview\d+|rc\d+|dev))?)`)
+
+// RubyVersion represents the version of a Ruby engine. Head versions have the
+// prerelease "head" and no version numbers.
+type RubyVersion struct {
+	Engine string
+	Major  int
+	Minor  int
+	Patch  int
+	// Revision is the fourth number of JRuby versions, e.g. "0" in
+	// "jruby-9.4.3.0", and empty for other engines
+	Revision   string
+	Prerelease string
+}
+
+// ParseRubyVersion parses the first Ruby version found in the given string,
+// e.g. in the output of "rvm current"
+func ParseRubyVersion(version string) (RubyVersion, error) {
+	matches := rubyVersionRegex.FindStringSubmatch(version)
+	if matches == nil {
+		return RubyVersion{}, fmt.Errorf("no string with ruby version found in: %s", version)
+	}
+
+	if matches[2] == "head" {
+		return RubyVersion{Engine: matches[1], Prerelease: "head"}, nil
+	}
+
+	rubyVersion := RubyVersion{Engine: matches[1], Revision: matches[6], Prerelease: matches[7]}
+	rubyVersion.Major, _ = strconv.Atoi(matches[3])
+	rubyVersion.Minor, _ = strconv.Atoi(matches[4])
+	if matches[5] != "" {
+		rubyVersion.Patch, _ = strconv.Atoi(matches[5])
+	}
+
+	return rubyVersion, nil
+}
+
+// IsHead reports whether the version is a head version built from source
+func (v RubyVersion) IsHead() bool {
+	return v.Prerelease == "head"
+}
+
+// String returns the version in the format used by RVM, e.g. "ruby-3.1.2"
+func (v RubyVersion) String() string {
+	if v.IsHead() {
+		return fmt.Sprintf("%s-head", v.Engine)
+	}
+
+	version := fmt.Sprintf("%s-%d.%d.%d", v.Engine, v.Major, v.Minor, v.Patch)
+	if v.Revision != "" {
+		version = fmt.Sprintf("%s.%s", version, v.Revision)
+	}
+	if v.Prerelease != "" {
+		version = fmt.Sprintf("%s-%s", version, v.Prerelease)
+	}
+
+	return version
+}
+
+// Satisfies checks the version numbers against a semver constraint like
+// ">= 2.6, < 3.0". The prerelease is ignored, so that a preview of Ruby 3.4
+// satisfies ">= 3.4". Head versions satisfy no constraint.
+func (v RubyVersion) Satisfies(constraint string) (bool, error) {
+	c, err := semver.NewConstraint(constraint)
+	if err != nil {
+		return false, err
+	}
+
+	if v.IsHead() {
+		return false, nil
+	}
+
+	return c.Check(semver.MustParse(fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch))), nil
+}
+
+// CacheKey returns the version used to decide if installed gems can be reused
+// with the given sensitivity, e.g. "ruby-3.1" for "minor". Prereleases and the
+// revision of JRuby versions are only part of the key for the sensitivity
+// "patch".
+func (v RubyVersion) CacheKey(sensitivity string) (string, error) {
+	if v.IsHead() {
+		return v.String(), nil
+	}
+
+	switch sensitivity {
+	case SensitivityPatch:
+		return v.String(), nil
+	case SensitivityMinor:
+		return fmt.Sprintf("%s-%d.%d", v.Engine, v.Major, v.Minor), nil
+	case SensitivityMajor:
+		return fmt.Sprintf("%s-%d", v.Engine, v.Major), nil
+	}
+
+	return "", fmt.Errorf("invalid ruby version cache key sensitivity '%s', must be one of %s, %s or %s", sensitivity, SensitivityPatch, SensitivityMinor, SensitivityMajor)
+}
@@ -0,0 +1,244 @@
+package bundler
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/paketo-buildpacks/packit/v2/scribe"
+)
+
+// Policies of the Ruby version consistency check
+const (
+	RubyVersionCheckWarn = "warn"
+	RubyVersionCheckFail = "fail"
+	RubyVersionCheckOff  = "off"
+)
+
+var (
+	gemfileRubyRegex    = regexp.MustCompile(`^\s*ruby[\s(]+((?:["'][^"']+["']\s*,?\s*)+)(.*)$`)
+	gemfileQuotedRegex  = regexp.MustCompile(`["']([^"']+)["']`)
+	gemfileEngineRegex  = regexp.MustCompile(`engine:\s*["']([^"']+)["']`)
+	gemfileEngineVRegex = regexp.MustCompile(`engine_version:\s*["']([^"']+)["']`)
+	lockRubyRegex       = regexp.MustCompile(`^(\d+)\.(\d+)\.(\d+)\S*(?:\s+\((\w+)\s+(\d+)\.(\d+)\.(\d+)\S*\))?`)
+	gemRequirementRegex = regexp.MustCompile(`^\s*(=|!=|>=|<=|>|<|~>)?\s*(\d+(?:\.\d+)*)\s*$`)
+)
+
+// GemfileRuby represents the "ruby" directive of a Gemfile
+type GemfileRuby struct {
+	Requirements  []string
+	Engine        string
+	EngineVersion string
+}
+
+// ParseGemfileRuby returns the "ruby" directive of the given Gemfile. The
+// returned bool is false if the Gemfile has none or only one reading the
+// version from a file.
+func ParseGemfileRuby(path string) (GemfileRuby, bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return GemfileRuby{}, false, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		matches := gemfileRubyRegex.FindStringSubmatch(scanner.Text())
+		if matches == nil {
+			continue
+		}
+
+		var gemfileRuby GemfileRuby
+		for _, requirement := range gemfileQuotedRegex.FindAllStringSubmatch(matches[1], -1) {
+			gemfileRuby.Requirements = append(gemfileRuby.Requirements, requirement[1])
+		}
+
+		if engine := gemfileEngineRegex.FindStringSubmatch(matches[2]); engine != nil {
+			gemfileRuby.Engine = engine[1]
+		}
+
+		if engineVersion := gemfileEngineVRegex.FindStringSubmatch(matches[2]); engineVersion != nil {
+			gemfileRuby.EngineVersion = engineVersion[1]
+		}
+
+		return gemfileRuby, true, nil
+	}
+
+	return GemfileRuby{}, false, scanner.Err()
+}
+
+// CheckRubyVersionConsistency compares the Ruby required by the "ruby"
+// directive of the Gemfile and the Ruby recorded in the "RUBY VERSION"
+// section of the Gemfile.lock with the active Ruby. Depending on the policy a
+// mismatch fails the build or is logged as a warning.
+func CheckRubyVersionConsistency(workingDir string, lock GemfileLock, active RubyVersion, configuration Configuration, logger scribe.Logger) error {
+	switch configuration.RubyVersionCheck {
+	case RubyVersionCheckOff:
+		return nil
+	case RubyVersionCheckWarn, RubyVersionCheckFail:
+	default:
+		return fmt.Errorf("invalid ruby version check policy '%s', must be one of %s, %s or %s", configuration.RubyVersionCheck, RubyVersionCheckWarn, RubyVersionCheckFail, RubyVersionCheckOff)
+	}
+
+	var mismatches []string
+
+	gemfileRuby, ok, err := ParseGemfileRuby(FindGemfile(workingDir).Path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	if ok {
+		mismatch, err := gemfileRubyMismatch(gemfileRuby, active)
+		if err != nil {
+			return err
+		}
+
+		if mismatch != "" {
+			mismatches = append(mismatches, mismatch)
+		}
+	}
+
+	if mismatch := lockRubyMismatch(lock.RubyVersion, active); mismatch != "" {
+		mismatches = append(mismatches, mismatch)
+	}
+
+	if len(mismatches) == 0 {
+		return nil
+	}
+
+	if configuration.RubyVersionCheck == RubyVersionCheckFail {
+		return errors.New(strings.Join(mismatches, "\n"))
+	}
+
+	for _, mismatch := range mismatches {
+		logger.Process("Warning: %s", mismatch)
+	}
+	logger.Break()
+
+	return nil
+}
+
+// gemfileRubyMismatch describes how the active Ruby doesn't match the "ruby"
+// directive of the Gemfile, or returns an empty string if it matches
+func gemfileRubyMismatch(gemfileRuby GemfileRuby, active RubyVersion) (string, error) {
+	if active.IsHead() {
+		return "", nil
+	}
+
+	engine := gemfileRuby.Engine
+	if engine == "" {
+		engine = EngineRuby
+	}
+
+	if engine != active.Engine {
+		return fmt.Sprintf("the Gemfile requires the Ruby engine '%s' but %s is active, fix the ruby directive in Gemfile or the Ruby installed by RVM", engine, active), nil
+	}
+
+	requirements := gemfileRuby.Requirements
+	if engine != EngineRuby {
+		// The Ruby version of other engines is the version of Ruby they're
+		// compatible with, the active version is the engine version
+		if gemfileRuby.EngineVersion == "" {
+			return "", nil
+		}
+		requirements = []string{gemfileRuby.EngineVersion}
+	}
+
+	constraint, ok := gemRequirementConstraint(requirements)
+	if !ok {
+		return "", nil
+	}
+
+	satisfied, err := active.Satisfies(constraint)
+	if err != nil {
+		return "", err
+	}
+
+	if satisfied {
+		return "", nil
+	}
+
+	return fmt.Sprintf("the Gemfile requires Ruby '%s' but %s is active, fix the ruby directive in Gemfile or the Ruby installed by RVM", strings.Join(requirements, "', '"), active), nil
+}
+
+// lockRubyMismatch describes how the active Ruby doesn't match the "RUBY
+// VERSION" of the Gemfile.lock, e.g. "3.1.4p223" or "3.1.4p0 (jruby 9.4.3.0)",
+// or returns an empty string if it matches
+func lockRubyMismatch(lockRubyVersion string, active RubyVersion) string {
+	matches := lockRubyRegex.FindStringSubmatch(lockRubyVersion)
+	if matches == nil || active.IsHead() {
+		return ""
+	}
+
+	engine, versions := EngineRuby, matches[1:4]
+	if matches[4] != "" {
+		engine, versions = matches[4], matches[5:8]
+	}
+
+	locked := RubyVersion{Engine: engine}
+	locked.Major, _ = strconv.Atoi(versions[0])
+	locked.Minor, _ = strconv.Atoi(versions[1])
+	locked.Patch, _ = strconv.Atoi(versions[2])
+
+	if locked.Engine == active.Engine && locked.Major == active.Major && locked.Minor == active.Minor && locked.Patch == active.Patch {
+		return ""
+	}
+
+	return fmt.Sprintf("Gemfile.lock was locked with %s but %s is active, run 'bundle update --ruby' and commit Gemfile.lock", locked, active)
+}
+
+// gemRequirementConstraint converts RubyGems requirements like "~> 3.1" to a
+// semver constraint. RubyGems requirements without an operator require the
+// exact version and "~>" allows the last given version segment to increase.
+// The returned bool is false if a requirement can't be converted, e.g. one
+// with a prerelease.
+func gemRequirementConstraint(requirements []string) (string, bool) {
+	var constraints []string
+	for _, requirement := range requirements {
+		matches := gemRequirementRegex.FindStringSubmatch(requirement)
+		if matches == nil {
+			return "", false
+		}
+
+		operator, version := matches[1], matches[2]
+		switch operator {
+		case "", "=":
+			constraints = append(constraints, fmt.Sprintf("= %s", semverSegments(version)))
+		case "~>":
+			segments := strings.Split(version, ".")
+			if len(segments) > 1 {
+				segments = segments[:len(segments)-1]
+			}
+
+			last, err := strconv.Atoi(segments[len(segments)-1])
+			if err != nil {
+				return "", false
+			}
+			segments[len(segments)-1] = strconv.Itoa(last + 1)
+
+			constraints = append(constraints,
+				fmt.Sprintf(">= %s", semverSegments(version)),
+				fmt.Sprintf("< %s", semverSegments(strings.Join(segments, "."))))
+		default:
+			constraints = append(constraints, fmt.Sprintf("%s %s", operator, semverSegments(version)))
+		}
+	}
+
+	return strings.Join(constraints, ", "), len(constraints) > 0
+}
+
+// semverSegments pads or truncates a version to the three segments of a
+// semver version, a constraint on a partial version like "3.1" would match
+// any 3.1.x version instead of 3.1.0 like RubyGems does
+func semverSegments(version string) string {
+	segments := strings.Split(version, ".")
+	for len(segments) < 3 {
+		segments = append(segments, "0")
+	}
+
+	return strings.Join(segments[:3], ".")
+}
@@ -0,0 +1,147 @@
+package bundler_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/avarteqgmbh/rvm-bundler-cnb/bundler"
+	"github.com/paketo-buildpacks/packit/v2/scribe"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testRubyVersionCheck(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+
+		workingDir    string
+		buffer        *bytes.Buffer
+		logger        scribe.Logger
+		active        bundler.RubyVersion
+		configuration bundler.Configuration
+	)
+
+	it.Before(func() {
+		var err error
+		workingDir, err = ioutil.TempDir("", "working-dir")
+		Expect(err).NotTo(HaveOccurred())
+
+		buffer = bytes.NewBuffer(nil)
+		logger = scribe.NewLogger(buffer)
+		active = bundler.RubyVersion{Engine: "ruby", Major: 3, Minor: 1, Patch: 4}
+		configuration = bundler.Configuration{RubyVersionCheck: "warn"}
+	})
+
+	it.After(func() {
+		Expect(os.RemoveAll(workingDir)).To(Succeed())
+	})
+
+	writeGemfile := func(contents string) {
+		Expect(ioutil.WriteFile(filepath.Join(workingDir, "Gemfile"), []byte(contents), 0644)).To(Succeed())
+	}
+
+	context("ParseGemfileRuby", func() {
+		it("parses the requirements", func() {
+			writeGemfile("source 'https://rubygems.org'\n\nruby '>= 3.0', '< 3.3'\n\ngem 'rack'\n")
+
+			gemfileRuby, ok, err := bundler.ParseGemfileRuby(filepath.Join(workingDir, "Gemfile"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ok).To(BeTrue())
+			Expect(gemfileRuby).To(Equal(bundler.GemfileRuby{Requirements: []string{">= 3.0", "< 3.3"}}))
+		})
+
+		it("parses the engine", func() {
+			writeGemfile("ruby \"3.1.4\", engine: \"jruby\", engine_version: \"9.4.3.0\"\n")
+
+			gemfileRuby, ok, err := bundler.ParseGemfileRuby(filepath.Join(workingDir, "Gemfile"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ok).To(BeTrue())
+			Expect(gemfileRuby).To(Equal(bundler.GemfileRuby{
+				Requirements:  []string{"3.1.4"},
+				Engine:        "jruby",
+				EngineVersion: "9.4.3.0",
+			}))
+		})
+
+		it("ignores a directive reading the version from a file", func() {
+			writeGemfile("ruby file: \".ruby-version\"\n")
+
+			_, ok, err := bundler.ParseGemfileRuby(filepath.Join(workingDir, "Gemfile"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ok).To(BeFalse())
+		})
+	})
+
+	context("CheckRubyVersionConsistency", func() {
+		it("accepts matching versions", func() {
+			writeGemfile("ruby '3.1.4'\n")
+			lock := bundler.GemfileLock{RubyVersion: "3.1.4p223"}
+
+			err := bundler.CheckRubyVersionConsistency(workingDir, lock, active, configuration, logger)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(buffer.String()).To(BeEmpty())
+		})
+
+		it("allows the last segment of a pessimistic requirement to increase", func() {
+			writeGemfile("ruby '~> 3.0'\n")
+
+			err := bundler.CheckRubyVersionConsistency(workingDir, bundler.GemfileLock{}, active, configuration, logger)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(buffer.String()).To(BeEmpty())
+		})
+
+		it("warns about a Gemfile requiring another version", func() {
+			writeGemfile("ruby '3.1'\n")
+
+			err := bundler.CheckRubyVersionConsistency(workingDir, bundler.GemfileLock{}, active, configuration, logger)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(buffer.String()).To(ContainSubstring("Warning: the Gemfile requires Ruby '3.1' but ruby-3.1.4 is active, fix the ruby directive in Gemfile"))
+		})
+
+		it("warns about a Gemfile requiring another engine", func() {
+			writeGemfile("ruby '3.1.4', engine: 'jruby', engine_version: '9.4.3.0'\n")
+
+			err := bundler.CheckRubyVersionConsistency(workingDir, bundler.GemfileLock{}, active, configuration, logger)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(buffer.String()).To(ContainSubstring("the Gemfile requires the Ruby engine 'jruby' but ruby-3.1.4 is active"))
+		})
+
+		it("compares the engine version of other engines", func() {
+			writeGemfile("ruby '3.1.4', engine: 'jruby', engine_version: '9.4.3.0'\n")
+			active = bundler.RubyVersion{Engine: "jruby", Major: 9, Minor: 4, Patch: 3}
+			lock := bundler.GemfileLock{RubyVersion: "3.1.4p0 (jruby 9.4.3.0)"}
+
+			err := bundler.CheckRubyVersionConsistency(workingDir, lock, active, configuration, logger)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(buffer.String()).To(BeEmpty())
+		})
+
+		it("fails on a lockfile locked with another version if the policy is fail", func() {
+			configuration.RubyVersionCheck = "fail"
+			lock := bundler.GemfileLock{RubyVersion: "3.0.6p216"}
+
+			err := bundler.CheckRubyVersionConsistency(workingDir, lock, active, configuration, logger)
+			Expect(err).To(MatchError("Gemfile.lock was locked with ruby-3.0.6 but ruby-3.1.4 is active, run 'bundle update --ruby' and commit Gemfile.lock"))
+		})
+
+		it("does nothing if the check is off", func() {
+			configuration.RubyVersionCheck = "off"
+			writeGemfile("ruby '2.7.8'\n")
+
+			err := bundler.CheckRubyVersionConsistency(workingDir, bundler.GemfileLock{}, active, configuration, logger)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(buffer.String()).To(BeEmpty())
+		})
+
+		it("returns an error for an invalid policy", func() {
+			configuration.RubyVersionCheck = "maybe"
+
+			err := bundler.CheckRubyVersionConsistency(workingDir, bundler.GemfileLock{}, active, configuration, logger)
+			Expect(err).To(MatchError("invalid ruby version check policy 'maybe', must be one of warn, fail or off"))
+		})
+	})
+}
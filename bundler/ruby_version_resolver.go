@@ -2,7 +2,6 @@ package bundler
 
 import (
 	"fmt"
-	"regexp"
 	"strings"
 )
 
@@ -16,30 +15,25 @@ func NewRubyVersionResolver() RubyVersionResolver {
 	return RubyVersionResolver{}
 }
 
-// Lookup returns the version of Ruby installed in the build environment.
-func (r RubyVersionResolver) Lookup(workingDir string, bashcmd BashCmd) (string, error) {
+// Lookup returns the version of Ruby installed in the build environment. It
+// asks RVM if it is available and the Ruby on the PATH otherwise. The engine
+// version is used for Ruby engines other than MRI, like "rvm current" does.
+func (r RubyVersionResolver) Lookup(workingDir string, bashcmd BashCmd) (RubyVersion, error) {
 	getRubyVersionCmd := strings.Join([]string{
 		"rvm",
 		"current",
 	}, " ")
+	if _, ok := RvmProfile(); !ok {
+		getRubyVersionCmd = strings.Join([]string{
+			"ruby",
+			"-e",
+			`'print RUBY_ENGINE, "-", RUBY_ENGINE_VERSION'`,
+		}, " ")
+	}
 	cmdStdOut, err := bashcmd.RunBashCmd(getRubyVersionCmd, workingDir)
 	if err != nil {
-		return "", fmt.Errorf("failed to obtain ruby version: %w: %s", err, cmdStdOut)
+		return RubyVersion{}, fmt.Errorf("failed to obtain ruby version: %w: %s", err, cmdStdOut)
 	}
 
-	var versions []string
-	regexes := []string{
-		`(jruby-\d+\.\d+\.\d+).\d+`,
-		`(jruby-\d+\.\d+)\.\d+`,
-		`(jruby-head)`,
-		`(ruby-\d+\.\d+)\.\d+`,
-		`(ruby-head)`,
-	}
-	for _, s := range regexes {
-		versions = regexp.MustCompile(s).FindStringSubmatch(cmdStdOut)
-		if versions != nil {
-			return versions[1], nil
-		}
-	}
-	return "", fmt.Errorf("no string with ruby version found")
+	return ParseRubyVersion(cmdStdOut)
 }
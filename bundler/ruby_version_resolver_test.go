@@ -4,6 +4,7 @@ import (
 	"errors"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/avarteqgmbh/rvm-bundler-cnb/bundler"
@@ -39,10 +40,78 @@ func testRubyVersionResolver(t *testing.T, context spec.G, it spec.S) {
 
 			result, err := resolver.Lookup(workingDir, bashCmd)
 			Expect(err).NotTo(HaveOccurred())
-			Expect(result).To(Equal("ruby-2.0"))
+			Expect(result).To(Equal(bundler.RubyVersion{Engine: "ruby", Major: 2, Minor: 0, Patch: 0}))
 			Expect(os.RemoveAll(workingDir)).To(Succeed())
 		})
 
+		context("with sample output of rvm current", func() {
+			for _, sample := range []struct {
+				Output  string
+				Version string
+			}{
+				{Output: "ruby-3.3.0\n", Version: "ruby-3.3.0"},
+				{Output: "ruby-3.2.2@my-gemset\n", Version: "ruby-3.2.2"},
+				{Output: "ruby-3.4.0-preview1\n", Version: "ruby-3.4.0-preview1"},
+				{Output: "ruby-head\n", Version: "ruby-head"},
+				{Output: "jruby-9.4.3.0\n", Version: "jruby-9.4.3.0"},
+				{Output: "jruby-head\n", Version: "jruby-head"},
+				{Output: "truffleruby-23.1.2\n", Version: "truffleruby-23.1.2"},
+				{Output: "truffleruby-head\n", Version: "truffleruby-head"},
+			} {
+				sample := sample
+
+				it("returns "+sample.Version, func() {
+					bashCmd.RunBashCmdCall.Returns.String = sample.Output
+
+					result, err := resolver.Lookup("/working-dir", bashCmd)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(result.String()).To(Equal(sample.Version))
+				})
+			}
+		})
+
+		context("when RVM is available", func() {
+			var rvmPath string
+
+			it.Before(func() {
+				var err error
+				rvmPath, err = ioutil.TempDir("", "rvm")
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(os.MkdirAll(filepath.Join(rvmPath, "profile.d"), os.ModePerm)).To(Succeed())
+				Expect(ioutil.WriteFile(filepath.Join(rvmPath, "profile.d", "rvm"), []byte(""), 0644)).To(Succeed())
+				Expect(os.Setenv("rvm_path", rvmPath)).To(Succeed())
+			})
+
+			it.After(func() {
+				Expect(os.Unsetenv("rvm_path")).To(Succeed())
+				Expect(os.RemoveAll(rvmPath)).To(Succeed())
+			})
+
+			it("asks RVM for the current Ruby", func() {
+				bashCmd.RunBashCmdCall.Returns.String = "ruby-3.3.0\n"
+
+				_, err := resolver.Lookup("/working-dir", bashCmd)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(bashCmd.RunBashCmdCall.Receives.Command).To(Equal("rvm current"))
+			})
+		})
+
+		context("when RVM isn't available", func() {
+			it.Before(func() {
+				Expect(os.Unsetenv("rvm_path")).To(Succeed())
+			})
+
+			it("asks the Ruby on the PATH for its engine and version", func() {
+				bashCmd.RunBashCmdCall.Returns.String = "jruby-9.4.3.0"
+
+				result, err := resolver.Lookup("/working-dir", bashCmd)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(bashCmd.RunBashCmdCall.Receives.Command).To(Equal(`ruby -e 'print RUBY_ENGINE, "-", RUBY_ENGINE_VERSION'`))
+				Expect(result.String()).To(Equal("jruby-9.4.3.0"))
+			})
+		})
+
 		it("Return an error on no ruby found", func() {
 			bashCmd.RunBashCmdCall.Returns.String = "some text"
 
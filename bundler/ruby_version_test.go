@@ -0,0 +1,127 @@
+package bundler_test
+
+import (
+	"testing"
+
+	"github.com/avarteqgmbh/rvm-bundler-cnb/bundler"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testRubyVersion(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+	)
+
+	context("ParseRubyVersion", func() {
+		it("parses an MRI version", func() {
+			version, err := bundler.ParseRubyVersion("ruby-3.1.2")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(version).To(Equal(bundler.RubyVersion{Engine: "ruby", Major: 3, Minor: 1, Patch: 2}))
+		})
+
+		it("parses a prerelease", func() {
+			version, err := bundler.ParseRubyVersion("ruby-3.4.0-preview1")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(version).To(Equal(bundler.RubyVersion{Engine: "ruby", Major: 3, Minor: 4, Patch: 0, Prerelease: "preview1"}))
+		})
+
+		it("parses a JRuby version with four components", func() {
+			version, err := bundler.ParseRubyVersion("jruby-9.4.3.0")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(version).To(Equal(bundler.RubyVersion{Engine: "jruby", Major: 9, Minor: 4, Patch: 3, Revision: "0"}))
+			Expect(version.String()).To(Equal("jruby-9.4.3.0"))
+		})
+
+		it("parses a TruffleRuby version", func() {
+			version, err := bundler.ParseRubyVersion("truffleruby-23.1.2")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(version).To(Equal(bundler.RubyVersion{Engine: "truffleruby", Major: 23, Minor: 1, Patch: 2}))
+		})
+
+		it("parses a head version", func() {
+			version, err := bundler.ParseRubyVersion("jruby-head")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(version).To(Equal(bundler.RubyVersion{Engine: "jruby", Prerelease: "head"}))
+			Expect(version.IsHead()).To(BeTrue())
+		})
+
+		it("returns an error if there is no version", func() {
+			_, err := bundler.ParseRubyVersion("system")
+			Expect(err).To(MatchError(ContainSubstring("no string with ruby version found")))
+		})
+	})
+
+	context("Satisfies", func() {
+		it("checks the version against a constraint", func() {
+			version := bundler.RubyVersion{Engine: "ruby", Major: 2, Minor: 7, Patch: 8}
+
+			ok, err := version.Satisfies(">= 2.6, < 2.8")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ok).To(BeTrue())
+
+			ok, err = version.Satisfies(">= 3")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ok).To(BeFalse())
+		})
+
+		it("ignores the prerelease", func() {
+			version := bundler.RubyVersion{Engine: "ruby", Major: 3, Minor: 4, Prerelease: "preview1"}
+
+			ok, err := version.Satisfies(">= 3.4")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ok).To(BeTrue())
+		})
+
+		it("doesn't satisfy any constraint for head versions", func() {
+			ok, err := bundler.RubyVersion{Engine: "ruby", Prerelease: "head"}.Satisfies(">= 0")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ok).To(BeFalse())
+		})
+
+		it("returns an error for an invalid constraint", func() {
+			_, err := bundler.RubyVersion{Engine: "ruby", Major: 3}.Satisfies("three")
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	context("CacheKey", func() {
+		version := bundler.RubyVersion{Engine: "ruby", Major: 3, Minor: 4, Patch: 1, Prerelease: "rc1"}
+
+		it("returns the key for each sensitivity", func() {
+			for sensitivity, key := range map[string]string{
+				"patch": "ruby-3.4.1-rc1",
+				"minor": "ruby-3.4",
+				"major": "ruby-3",
+			} {
+				result, err := version.CacheKey(sensitivity)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(result).To(Equal(key))
+			}
+		})
+
+		it("tells JRuby revisions apart for the sensitivity patch", func() {
+			for revision, key := range map[string]string{"0": "jruby-9.4.3.0", "1": "jruby-9.4.3.1"} {
+				result, err := bundler.RubyVersion{Engine: "jruby", Major: 9, Minor: 4, Patch: 3, Revision: revision}.CacheKey("patch")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(result).To(Equal(key))
+			}
+
+			result, err := bundler.RubyVersion{Engine: "jruby", Major: 9, Minor: 4, Patch: 3, Revision: "1"}.CacheKey("minor")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result).To(Equal("jruby-9.4"))
+		})
+
+		it("returns the head version for any sensitivity", func() {
+			result, err := bundler.RubyVersion{Engine: "ruby", Prerelease: "head"}.CacheKey("major")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result).To(Equal("ruby-head"))
+		})
+
+		it("returns an error for an invalid sensitivity", func() {
+			_, err := version.CacheKey("build")
+			Expect(err).To(MatchError("invalid ruby version cache key sensitivity 'build', must be one of patch, minor or major"))
+		})
+	})
+}
@@ -0,0 +1,42 @@
+package bundler
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/paketo-buildpacks/packit/v2/scribe"
+)
+
+// VerifyBundle runs "bundle check" and the configured smoke command, by
+// default requiring every gem of the default group, if verification is
+// enabled. A failure is returned with the output of the failed command, so
+// that problems like a missing native library are found during the build
+// instead of at launch.
+func VerifyBundle(workingDir string, configuration Configuration, bashcmd BashCmd, logger scribe.Logger) error {
+	if !configuration.Verify {
+		return nil
+	}
+
+	logger.Process("Verifying the bundle")
+
+	bundleCheckCmd := strings.Join([]string{
+		"bundle",
+		"check",
+	}, " ")
+	output, err := bashcmd.RunBashCmd(bundleCheckCmd, workingDir)
+	if err != nil {
+		return fmt.Errorf("bundle verification failed: '%s' failed: %w\n%s", bundleCheckCmd, err, output)
+	}
+
+	if configuration.SmokeCommand != "" {
+		output, err = bashcmd.RunBashCmd(configuration.SmokeCommand, workingDir)
+		if err != nil {
+			return fmt.Errorf("bundle verification failed: smoke command '%s' failed: %w\n%s", configuration.SmokeCommand, err, output)
+		}
+	}
+
+	logger.Action("Bundle verified")
+	logger.Break()
+
+	return nil
+}
@@ -0,0 +1,80 @@
+package bundler_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/avarteqgmbh/rvm-bundler-cnb/bundler"
+	"github.com/avarteqgmbh/rvm-bundler-cnb/bundler/fakes"
+	"github.com/paketo-buildpacks/packit/v2/scribe"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testVerify(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+
+		bashCmd       *fakes.BashCmd
+		commands      []string
+		logger        scribe.Logger
+		configuration bundler.Configuration
+	)
+
+	it.Before(func() {
+		commands = nil
+		bashCmd = &fakes.BashCmd{}
+		bashCmd.RunBashCmdCall.Stub = func(command string, workingDir string) (string, error) {
+			commands = append(commands, command)
+			return "", nil
+		}
+
+		logger = scribe.NewLogger(bytes.NewBuffer(nil))
+		configuration = bundler.Configuration{
+			Verify:       true,
+			SmokeCommand: `ruby -e 'require "bundler/setup"; Bundler.require(:default)'`,
+		}
+	})
+
+	it("runs bundle check and the smoke command", func() {
+		err := bundler.VerifyBundle("/working-dir", configuration, bashCmd, logger)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(commands).To(Equal([]string{
+			"bundle check",
+			`ruby -e 'require "bundler/setup"; Bundler.require(:default)'`,
+		}))
+	})
+
+	it("does nothing if verification is disabled", func() {
+		configuration.Verify = false
+
+		err := bundler.VerifyBundle("/working-dir", configuration, bashCmd, logger)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(commands).To(BeEmpty())
+	})
+
+	it("returns the output of a failed bundle check", func() {
+		bashCmd.RunBashCmdCall.Stub = func(command string, workingDir string) (string, error) {
+			return "The following gems are missing\n * rack (2.2.4)\n", errors.New("exit status 1")
+		}
+
+		err := bundler.VerifyBundle("/working-dir", configuration, bashCmd, logger)
+		Expect(err).To(MatchError(ContainSubstring("'bundle check' failed: exit status 1")))
+		Expect(err).To(MatchError(ContainSubstring("* rack (2.2.4)")))
+	})
+
+	it("returns the output of a failed smoke command", func() {
+		bashCmd.RunBashCmdCall.Stub = func(command string, workingDir string) (string, error) {
+			if command == "bundle check" {
+				return "", nil
+			}
+			return "libpq.so.5: cannot open shared object file\n", errors.New("exit status 1")
+		}
+
+		err := bundler.VerifyBundle("/working-dir", configuration, bashCmd, logger)
+		Expect(err).To(MatchError(ContainSubstring("smoke command")))
+		Expect(err).To(MatchError(ContainSubstring("libpq.so.5: cannot open shared object file")))
+	})
+}
@@ -0,0 +1,139 @@
+package bundler
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/paketo-buildpacks/packit/v2"
+	"github.com/paketo-buildpacks/packit/v2/scribe"
+)
+
+// The web servers supported by this buildpack. WebServerAuto selects the web
+// server based on the gems present in Gemfile.lock.
+const (
+	WebServerAuto      = "auto"
+	WebServerPuma      = "puma"
+	WebServerUnicorn   = "unicorn"
+	WebServerFalcon    = "falcon"
+	WebServerPassenger = "passenger"
+	WebServerThin      = "thin"
+	WebServerRackup    = "rackup"
+)
+
+// lockedWebServers lists the web servers that are selected automatically if
+// their gem is present in Gemfile.lock, in the order of preference
+var lockedWebServers = []string{
+	WebServerPuma,
+	WebServerUnicorn,
+	WebServerFalcon,
+	WebServerPassenger,
+	WebServerThin,
+}
+
+// SelectWebServer returns the web server the application is going to be run
+// with. Unless a web server is explicitly configured, the first web server
+// found in Gemfile.lock is used. If Gemfile.lock contains none of the
+// supported web servers, Puma is used if this buildpack is configured to
+// install it and "rackup" otherwise.
+func SelectWebServer(workingDir string, configuration Configuration) (string, error) {
+	switch configuration.WebServer {
+	case "", WebServerAuto:
+	case WebServerRackup:
+		return WebServerRackup, nil
+	default:
+		if !contains(lockedWebServers, configuration.WebServer) {
+			return "", fmt.Errorf("unsupported web server: %s", configuration.WebServer)
+		}
+		return configuration.WebServer, nil
+	}
+
+	lock, err := ParseGemfileLock(FindGemfile(workingDir).LockPath)
+	if err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+
+	for _, server := range lockedWebServers {
+		if lock.Has(server) {
+			return server, nil
+		}
+	}
+
+	if configuration.InstallPuma {
+		return WebServerPuma, nil
+	}
+
+	return WebServerRackup, nil
+}
+
+// WebServerProcess returns the process of type "web" running the given web
+// server
+func WebServerProcess(server string, configuration Configuration) packit.Process {
+	command := "puma"
+
+	switch server {
+	case WebServerUnicorn:
+		command = "unicorn -c config/unicorn.rb"
+	case WebServerFalcon:
+		command = fmt.Sprintf("falcon serve --bind http://0.0.0.0:%s --count %s",
+			configuration.Server.Port, configuration.Server.Workers)
+	case WebServerPassenger:
+		command = fmt.Sprintf("passenger start --port %s --max-pool-size %s --log-file /dev/stdout",
+			configuration.Server.Port, configuration.Server.Workers)
+	case WebServerThin:
+		command = fmt.Sprintf("thin start --address 0.0.0.0 --port %s --timeout %s",
+			configuration.Server.Port, configuration.Server.Timeout)
+	case WebServerRackup:
+		command = fmt.Sprintf("rackup --host 0.0.0.0 --port %s", configuration.Server.Port)
+	}
+
+	return packit.Process{
+		Type:    "web",
+		Command: bundleExec(configuration, command),
+		Default: true,
+	}
+}
+
+// ConfigureWebServer creates the configuration file of the given web server
+// if it needs one and the application doesn't supply it. Nothing is created
+// if the Procfile defines the process of type "web" itself. The configuration
+// of Puma is created by the PumaInstaller.
+func ConfigureWebServer(workingDir string, server string, configuration Configuration, logger scribe.Logger) error {
+	if server != WebServerUnicorn {
+		return nil
+	}
+
+	procfileWeb, err := ProcfileHasProcess(workingDir, "web")
+	if err != nil {
+		return err
+	}
+	if procfileWeb {
+		logger.Process("Not creating config/unicorn.rb because the Procfile defines the process type 'web'")
+		return nil
+	}
+
+	configUnicornRbPath := filepath.Join(workingDir, "config", "unicorn.rb")
+	_, err = os.Stat(configUnicornRbPath)
+	if err == nil {
+		logger.Process("Using config/unicorn.rb supplied by application")
+		return nil
+	}
+	if !os.IsNotExist(err) {
+		return err
+	}
+
+	logger.Process("Creating configuration file for Unicorn at: '%s'", configUnicornRbPath)
+
+	err = os.MkdirAll(filepath.Dir(configUnicornRbPath), os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	unicorncfg := ""
+	unicorncfg += fmt.Sprintf("listen %s\n", configuration.Server.Port)
+	unicorncfg += fmt.Sprintf("worker_processes %s\n", configuration.Server.Workers)
+	unicorncfg += fmt.Sprintf("timeout %s\n", configuration.Server.Timeout)
+	unicorncfg += "preload_app true\n"
+
+	return os.WriteFile(configUnicornRbPath, []byte(unicorncfg), 0644)
+}
@@ -0,0 +1,164 @@
+package bundler_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/avarteqgmbh/rvm-bundler-cnb/bundler"
+	"github.com/paketo-buildpacks/packit/v2"
+	"github.com/paketo-buildpacks/packit/v2/scribe"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testWebServer(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+
+		workingDir    string
+		configuration bundler.Configuration
+	)
+
+	it.Before(func() {
+		var err error
+		workingDir, err = ioutil.TempDir("", "working-dir")
+		Expect(err).NotTo(HaveOccurred())
+
+		configuration = bundler.Configuration{
+			InstallPuma: true,
+			WebServer:   "auto",
+			Server: bundler.Server{
+				Port:    "8080",
+				Workers: "2",
+				Timeout: "30",
+			},
+		}
+	})
+
+	it.After(func() {
+		Expect(os.RemoveAll(workingDir)).To(Succeed())
+	})
+
+	context("SelectWebServer", func() {
+		it("selects the web server present in Gemfile.lock", func() {
+			err := ioutil.WriteFile(filepath.Join(workingDir, "Gemfile.lock"), []byte("GEM\n  specs:\n    unicorn (6.1.0)\n"), 0644)
+			Expect(err).NotTo(HaveOccurred())
+
+			server, err := bundler.SelectWebServer(workingDir, configuration)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(server).To(Equal("unicorn"))
+		})
+
+		it("prefers Puma if several web servers are locked", func() {
+			err := ioutil.WriteFile(filepath.Join(workingDir, "Gemfile.lock"), []byte("GEM\n  specs:\n    thin (1.8.1)\n    puma (5.6.4)\n"), 0644)
+			Expect(err).NotTo(HaveOccurred())
+
+			server, err := bundler.SelectWebServer(workingDir, configuration)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(server).To(Equal("puma"))
+		})
+
+		it("falls back to Puma if no web server is locked and Puma is installed", func() {
+			server, err := bundler.SelectWebServer(workingDir, configuration)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(server).To(Equal("puma"))
+		})
+
+		it("falls back to rackup if no web server is locked and Puma isn't installed", func() {
+			configuration.InstallPuma = false
+
+			server, err := bundler.SelectWebServer(workingDir, configuration)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(server).To(Equal("rackup"))
+		})
+
+		it("returns the configured web server", func() {
+			configuration.WebServer = "falcon"
+
+			server, err := bundler.SelectWebServer(workingDir, configuration)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(server).To(Equal("falcon"))
+		})
+
+		it("returns an error for an unsupported web server", func() {
+			configuration.WebServer = "webrick"
+
+			_, err := bundler.SelectWebServer(workingDir, configuration)
+			Expect(err).To(MatchError("unsupported web server: webrick"))
+		})
+	})
+
+	context("WebServerProcess", func() {
+		it("returns the web process of each web server", func() {
+			commands := map[string]string{
+				"puma":      "bundle exec puma",
+				"unicorn":   "bundle exec unicorn -c config/unicorn.rb",
+				"falcon":    "bundle exec falcon serve --bind http://0.0.0.0:8080 --count 2",
+				"passenger": "bundle exec passenger start --port 8080 --max-pool-size 2 --log-file /dev/stdout",
+				"thin":      "bundle exec thin start --address 0.0.0.0 --port 8080 --timeout 30",
+				"rackup":    "bundle exec rackup --host 0.0.0.0 --port 8080",
+			}
+
+			for server, command := range commands {
+				Expect(bundler.WebServerProcess(server, configuration)).To(Equal(packit.Process{
+					Type:    "web",
+					Command: command,
+					Default: true,
+				}))
+			}
+		})
+
+		it("returns a web process without 'bundle exec' in standalone mode", func() {
+			configuration.Standalone = true
+
+			Expect(bundler.WebServerProcess("unicorn", configuration).Command).To(Equal("unicorn -c config/unicorn.rb"))
+		})
+	})
+
+	context("ConfigureWebServer", func() {
+		var logger scribe.Logger
+
+		it.Before(func() {
+			logger = scribe.NewLogger(bytes.NewBuffer(nil))
+		})
+
+		it("creates config/unicorn.rb for Unicorn", func() {
+			err := bundler.ConfigureWebServer(workingDir, "unicorn", configuration, logger)
+			Expect(err).NotTo(HaveOccurred())
+
+			contents, err := ioutil.ReadFile(filepath.Join(workingDir, "config", "unicorn.rb"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(contents)).To(Equal("listen 8080\nworker_processes 2\ntimeout 30\npreload_app true\n"))
+		})
+
+		it("keeps the config/unicorn.rb supplied by the application", func() {
+			Expect(os.MkdirAll(filepath.Join(workingDir, "config"), os.ModePerm)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(workingDir, "config", "unicorn.rb"), []byte("listen 3000\n"), 0644)).To(Succeed())
+
+			err := bundler.ConfigureWebServer(workingDir, "unicorn", configuration, logger)
+			Expect(err).NotTo(HaveOccurred())
+
+			contents, err := ioutil.ReadFile(filepath.Join(workingDir, "config", "unicorn.rb"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(contents)).To(Equal("listen 3000\n"))
+		})
+
+		it("creates no config/unicorn.rb if the Procfile defines the web process", func() {
+			Expect(ioutil.WriteFile(filepath.Join(workingDir, "Procfile"), []byte("web: bundle exec unicorn -c unicorn.conf.rb\n"), 0644)).To(Succeed())
+
+			err := bundler.ConfigureWebServer(workingDir, "unicorn", configuration, logger)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(filepath.Join(workingDir, "config", "unicorn.rb")).NotTo(BeAnExistingFile())
+		})
+
+		it("creates no configuration for other web servers", func() {
+			err := bundler.ConfigureWebServer(workingDir, "thin", configuration, logger)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(filepath.Join(workingDir, "config")).NotTo(BeADirectory())
+		})
+	})
+}
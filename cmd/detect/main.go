@@ -13,5 +13,8 @@ func main() {
 	logger := rvm.NewLogEmitter(os.Stdout)
 	bundlerVersionParser := bundler.NewBundlerVersionParser()
 	buildpackYMLParser := bundler.NewBuildpackYMLParser()
-	packit.Detect(bundler.Detect(logger, bundlerVersionParser, buildpackYMLParser))
+	rubyVersionParser := rvm.NewRubyVersionParser()
+	gemfileParser := rvm.NewGemfileParser()
+	gemfileLockParser := rvm.NewGemfileLockParser()
+	packit.Detect(bundler.Detect(logger, bundlerVersionParser, buildpackYMLParser, rubyVersionParser, gemfileParser, gemfileLockParser))
 }
@@ -4,6 +4,7 @@ go 1.18
 
 require (
 	github.com/BurntSushi/toml v1.1.0
+	github.com/Masterminds/semver/v3 v3.1.1
 	github.com/avarteqgmbh/rvm-cnb v0.1.18
 	github.com/onsi/gomega v1.19.0
 	github.com/paketo-buildpacks/occam v0.9.0
@@ -15,7 +16,6 @@ require (
 require (
 	github.com/Azure/go-ansiterm v0.0.0-20210617225240-d185dfc1b5a1 // indirect
 	github.com/ForestEckhardt/freezer v0.0.11 // indirect
-	github.com/Masterminds/semver/v3 v3.1.1 // indirect
 	github.com/Microsoft/go-winio v0.5.2 // indirect
 	github.com/Microsoft/hcsshim v0.9.3 // indirect
 	github.com/cenkalti/backoff/v4 v4.1.3 // indirect
@@ -60,7 +60,6 @@ func testDefault(t *testing.T, context spec.G, it spec.S) {
 				WithBuildpacks(
 					settings.Buildpacks.RVM.Online,
 					settings.Buildpacks.Bundler.Online,
-					settings.Buildpacks.BuildPlan.Online,
 				).
 				WithEnv(map[string]string{"BP_LOG_LEVEL": "DEBUG"}).
 				WithPullPolicy("never").
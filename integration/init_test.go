@@ -21,9 +21,6 @@ var settings struct {
 			Online  string
 			Offline string
 		}
-		BuildPlan struct {
-			Online string
-		}
 		RVM struct {
 			Online  string
 			Offline string
@@ -36,8 +33,7 @@ var settings struct {
 	}
 
 	Config struct {
-		BuildPlan string `json:"build-plan"`
-		RVM       string `json:"rvm"`
+		RVM string `json:"rvm"`
 	}
 }
 
@@ -73,10 +69,6 @@ func TestIntegration(t *testing.T) {
 		Execute(root)
 	Expect(err).NotTo(HaveOccurred())
 
-	settings.Buildpacks.BuildPlan.Online, err = buildpackStore.Get.
-		Execute(settings.Config.BuildPlan)
-	Expect(err).ToNot(HaveOccurred())
-
 	settings.Buildpacks.RVM.Online, err = buildpackStore.Get.
 		Execute(settings.Config.RVM)
 	Expect(err).ToNot(HaveOccurred())
@@ -76,7 +76,6 @@ func testLayerReuse(t *testing.T, context spec.G, it spec.S) {
 				WithBuildpacks(
 					settings.Buildpacks.RVM.Online,
 					settings.Buildpacks.Bundler.Online,
-					settings.Buildpacks.BuildPlan.Online,
 				)
 
 			firstImage, _, err = build.Execute(name, source)
@@ -155,7 +154,6 @@ func testLayerReuse(t *testing.T, context spec.G, it spec.S) {
 					WithBuildpacks(
 						settings.Buildpacks.RVM.Online,
 						settings.Buildpacks.Bundler.Online,
-						settings.Buildpacks.BuildPlan.Online,
 					)
 
 				firstImage, _, err = build.Execute(name, source)
@@ -234,7 +232,6 @@ func testLayerReuse(t *testing.T, context spec.G, it spec.S) {
 					WithBuildpacks(
 						settings.Buildpacks.RVM.Online,
 						settings.Buildpacks.Bundler.Online,
-						settings.Buildpacks.BuildPlan.Online,
 					)
 
 				firstImage, _, err = build.Execute(name, source)
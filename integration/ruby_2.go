@@ -62,7 +62,6 @@ func testRuby2(t *testing.T, context spec.G, it spec.S) {
 				WithBuildpacks(
 					settings.Buildpacks.RVM.Online,
 					settings.Buildpacks.Bundler.Online,
-					settings.Buildpacks.BuildPlan.Online,
 				).
 				Execute(name, source)
 			Expect(err).ToNot(HaveOccurred(), logs.String)